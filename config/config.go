@@ -4,6 +4,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +15,13 @@ type Config struct {
 	Site     SiteConfig
 	Database DatabaseConfig
 	JWT      JWTConfig
+	Ingest   IngestConfig
+	Spool    SpoolConfig
+	Limit    RateLimitConfig
+	Revenue  RevenueConfig
+	Traffic  TrafficConfig
+	Privacy  PrivacyConfig
+	Geo      GeoConfig
 }
 
 var cfg *Config
@@ -22,8 +31,10 @@ func GetConfig() *Config {
 }
 
 type ServerConfig struct {
-	Port string
-	Mode string // debug or release
+	Port           string
+	Mode           string   // debug or release
+	TrustedProxies []string // 信任的反向代理/CDN 的 IP 或 CIDR，只有来自这些地址的请求才读取代理头中的客户端IP
+	ClientIPHeader string   // 代理写入客户端IP的请求头，只读取这一个
 }
 
 type SiteConfig struct {
@@ -31,6 +42,7 @@ type SiteConfig struct {
 	SiteName          string
 	VERSION           string
 	TrackerScriptName string
+	TrackerEndpoint   string // 追踪脚本的上报地址，为空时使用脚本所在域名的 /send
 	RegMode           bool
 }
 
@@ -50,6 +62,66 @@ type JWTConfig struct {
 	RefreshExpire int
 }
 
+// IngestConfig 事件异步写入队列配置
+type IngestConfig struct {
+	QueueSize     int           // 队列容量，超出后拒绝新事件
+	Workers       int           // 写入协程数
+	BatchSize     int           // 单批最大事件数
+	FlushInterval time.Duration // 定时刷新间隔
+	MaxBatch      int           // 批量上报单次最多事件数
+	DedupeWindow  time.Duration // 同一会话同一页面的重复浏览在该时间内只记录一次，0 为关闭
+	EventIDTTL    time.Duration // 客户端事件ID的去重有效期，0 为关闭
+}
+
+// SpoolConfig 数据库不可用时的本地暂存配置
+type SpoolConfig struct {
+	Dir            string        // 暂存目录
+	SegmentSize    int64         // 单个分段文件大小上限（字节）
+	ReplayInterval time.Duration // 回放检查间隔
+}
+
+// RateLimitConfig 上报接口限流配置
+type RateLimitConfig struct {
+	Enabled      bool
+	ClientRate   float64       // 每个 (站点, 匿名化IP) 每秒允许的上报数
+	ClientBurst  int           // 每个客户端允许的突发上报数
+	SiteRate     float64       // 每个站点整体每秒允许的上报数
+	SiteBurst    int           // 每个站点允许的突发上报数
+	BanThreshold int           // 窗口内超限多少次后临时封禁，0 表示不封禁
+	BanWindow    time.Duration // 超限次数统计窗口
+	BanDuration  time.Duration // 封禁时长
+}
+
+// RevenueConfig 收入统计配置
+type RevenueConfig struct {
+	DefaultCurrency string             // 站点未设置报表货币时使用的货币
+	Rates           map[string]float64 // 各货币兑基准货币的汇率，用于换算到站点报表货币
+}
+
+// TrafficConfig 流量来源分类配置
+type TrafficConfig struct {
+	ChannelRulesFile   string        // 自定义渠道规则文件，优先于内置规则匹配，为空时只使用内置规则
+	SpamFile           string        // 来源垃圾域名列表文件，与内置列表合并，为空时只使用内置列表
+	SpamAction         string        // 命中垃圾来源时的处理方式：drop 丢弃，flag 标记后保留但不计入统计
+	SpamReloadInterval time.Duration // 列表文件修改检查间隔
+}
+
+// PrivacyConfig 访客隐私配置
+type PrivacyConfig struct {
+	IPHashKey string // 站点 IP 模式为 hash 时使用的密钥，为空时使用 JWT_SECRET_KEY
+}
+
+// GeoConfig IP 地理位置数据源配置
+type GeoConfig struct {
+	Provider  string // 数据源：qqwry 纯真 IP 库，mmdb MaxMind/DB-IP 数据库
+	QQwryFile string // 纯真 IP 库（ipdb 格式）路径
+	MMDBFile  string // MMDB 城市库路径，如 GeoLite2-City.mmdb、dbip-city-lite.mmdb
+	ASNFile   string // MMDB ASN 库路径，为空时不查询 ASN
+	Language  string // 地名显示语言：zh 或 en
+
+	ReloadInterval time.Duration // 数据库文件修改检查间隔，0 表示不自动重新加载
+}
+
 func Load() *Config {
 	err := godotenv.Load()
 	if err != nil {
@@ -59,12 +131,16 @@ func Load() *Config {
 		Server: ServerConfig{
 			Port: getEnv("SERVER_PORT", "8080"),
 			Mode: getEnv("GIN_MODE", "debug"),
+
+			TrustedProxies: getEnvAsList("TRUSTED_PROXIES", "127.0.0.1,::1"),
+			ClientIPHeader: getEnv("CLIENT_IP_HEADER", "X-Forwarded-For"),
 		},
 		Site: SiteConfig{
 			SiteUrl:           getEnv("SITE_DOMAIN", "http://localhost:5004"),
 			SiteName:          getEnv("SITE_NAME", "Pingoo"),
 			VERSION:           getEnv("VERSION", "1.0.0"),
 			TrackerScriptName: getEnv("TRACKER_SCRIPT_NAME", "pingoo.js"),
+			TrackerEndpoint:   getEnv("TRACKER_ENDPOINT", ""),
 			RegMode:           getEnvAsBool("REG_MODE", false),
 		},
 		Database: DatabaseConfig{
@@ -81,6 +157,56 @@ func Load() *Config {
 			ExpireHours:   getEnvAsInt("JWT_EXPIRE_HOURS", 24),
 			RefreshExpire: getEnvAsInt("JWT_REFRESH_EXPIRE", 168),
 		},
+		Ingest: IngestConfig{
+			QueueSize:     getEnvAsInt("INGEST_QUEUE_SIZE", 10000),
+			Workers:       getEnvAsInt("INGEST_WORKERS", 4),
+			BatchSize:     getEnvAsInt("INGEST_BATCH_SIZE", 200),
+			FlushInterval: getEnvAsDuration("INGEST_FLUSH_INTERVAL", 2*time.Second),
+			MaxBatch:      getEnvAsInt("INGEST_MAX_BATCH", 100),
+			DedupeWindow:  getEnvAsDuration("INGEST_DEDUPE_WINDOW", 5*time.Second),
+			EventIDTTL:    getEnvAsDuration("INGEST_EVENT_ID_TTL", 10*time.Minute),
+		},
+		Spool: SpoolConfig{
+			Dir:            getEnv("SPOOL_DIR", "data/spool"),
+			SegmentSize:    int64(getEnvAsInt("SPOOL_SEGMENT_SIZE_MB", 8)) << 20,
+			ReplayInterval: getEnvAsDuration("SPOOL_REPLAY_INTERVAL", 30*time.Second),
+		},
+		Limit: RateLimitConfig{
+			Enabled:      getEnvAsBool("RATE_LIMIT_ENABLED", true),
+			ClientRate:   getEnvAsFloat("RATE_LIMIT_CLIENT_RATE", 5),
+			ClientBurst:  getEnvAsInt("RATE_LIMIT_CLIENT_BURST", 30),
+			SiteRate:     getEnvAsFloat("RATE_LIMIT_SITE_RATE", 500),
+			SiteBurst:    getEnvAsInt("RATE_LIMIT_SITE_BURST", 2000),
+			BanThreshold: getEnvAsInt("RATE_LIMIT_BAN_THRESHOLD", 100),
+			BanWindow:    getEnvAsDuration("RATE_LIMIT_BAN_WINDOW", 10*time.Minute),
+			BanDuration:  getEnvAsDuration("RATE_LIMIT_BAN_DURATION", time.Hour),
+		},
+		Revenue: RevenueConfig{
+			DefaultCurrency: strings.ToUpper(getEnv("REVENUE_DEFAULT_CURRENCY", "CNY")),
+			Rates:           getEnvAsRates("REVENUE_CURRENCY_RATES", "CNY:1,USD:7.1,EUR:8.3,GBP:9.5,HKD:0.91,JPY:0.047"),
+		},
+		Traffic: TrafficConfig{
+			ChannelRulesFile:   getEnv("CHANNEL_RULES_FILE", ""),
+			SpamFile:           getEnv("REFERRER_SPAM_FILE", ""),
+			SpamAction:         getEnv("REFERRER_SPAM_ACTION", "drop"),
+			SpamReloadInterval: getEnvAsDuration("REFERRER_SPAM_RELOAD_INTERVAL", time.Minute),
+		},
+		Privacy: PrivacyConfig{
+			IPHashKey: getEnv("IP_HASH_KEY", ""),
+		},
+		Geo: GeoConfig{
+			Provider:  getEnv("GEO_PROVIDER", "qqwry"),
+			QQwryFile: getEnv("GEO_QQWRY_FILE", "public/qqwry.ipdb"),
+			MMDBFile:  getEnv("GEO_MMDB_FILE", "data/GeoLite2-City.mmdb"),
+			ASNFile:   getEnv("GEO_ASN_FILE", ""),
+			Language:  getEnv("GEO_LANGUAGE", "zh"),
+
+			ReloadInterval: getEnvAsDuration("GEO_RELOAD_INTERVAL", time.Minute),
+		},
+	}
+	// TRUSTED_PROXIES=none 时不信任任何代理，直接使用连接的对端地址
+	if len(cfg.Server.TrustedProxies) == 1 && cfg.Server.TrustedProxies[0] == "none" {
+		cfg.Server.TrustedProxies = nil
 	}
 	return cfg
 }
@@ -101,6 +227,15 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -109,3 +244,40 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsList 解析逗号分隔的列表，忽略空项
+func getEnvAsList(key, defaultValue string) []string {
+	var items []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvAsRates 解析 "USD:7.1,EUR:8.3" 格式的汇率表，货币代码统一为大写
+func getEnvAsRates(key, defaultValue string) map[string]float64 {
+	rates := make(map[string]float64)
+	for _, pair := range strings.Split(getEnv(key, defaultValue), ",") {
+		code, value, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			continue
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || rate <= 0 {
+			continue
+		}
+		rates[strings.ToUpper(strings.TrimSpace(code))] = rate
+	}
+	return rates
+}
@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"pingoo/services"
+	"pingoo/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminController 系统管理控制器，仅管理员可访问
+type AdminController struct{}
+
+// NewAdminController 创建系统管理控制器
+func NewAdminController() *AdminController {
+	return &AdminController{}
+}
+
+// GeoStatus 获取IP地理位置数据库的加载状态和版本
+func (ac *AdminController) GeoStatus(c *gin.Context) {
+	geoDB := services.GetGeoDatabase()
+	if geoDB == nil {
+		utils.ServerError(c, "IP地理位置数据库未初始化")
+		return
+	}
+	utils.Success(c, geoDB.Status())
+}
+
+// ReloadGeo 重新加载IP地理位置数据库，新文件校验失败时继续使用旧数据库
+func (ac *AdminController) ReloadGeo(c *gin.Context) {
+	geoDB := services.GetGeoDatabase()
+	if geoDB == nil {
+		utils.ServerError(c, "IP地理位置数据库未初始化")
+		return
+	}
+	if err := geoDB.Reload(); err != nil {
+		utils.Fail(c, "重新加载IP地理位置数据库失败: "+err.Error())
+		return
+	}
+	utils.Success(c, geoDB.Status())
+}
@@ -1,26 +1,37 @@
 package controllers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
+	"pingoo/config"
 	"pingoo/middleware"
 	"pingoo/models"
 	"pingoo/services"
 	"pingoo/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 type EventController struct {
 	eventService *services.EventService
+	ingestQueue  *services.IngestQueue
 }
 
 // NewEventController 创建事件控制器实例
 func NewEventController() *EventController {
 	return &EventController{
 		eventService: services.NewEventService(),
+		ingestQueue:  services.GetIngestQueue(),
 	}
 }
 
@@ -44,15 +55,18 @@ func (ec *EventController) CreateEvent(c *gin.Context) {
 	if eventCreate.IP == "" {
 		eventCreate.IP = c.ClientIP()
 	}
-	// 从ip提取国家等信息
-	ipInfo, err := utils.QueryIP(eventCreate.IP)
-	if err != nil {
-		log.Println(err)
-	}
+	// 从截断后的ip提取国家等信息
+	ipInfo := services.LookupGeo(eventCreate.IP)
 	eventCreate.Country = ipInfo.Country
 	eventCreate.Subdivision = ipInfo.Region
 	eventCreate.City = ipInfo.City
 	eventCreate.Isp = ipInfo.ISP
+	eventCreate.CountryCode = ipInfo.CountryCode
+	eventCreate.RegionCode = ipInfo.RegionCode
+	eventCreate.ASN = ipInfo.ASN
+	// 按站点设置处理 IP，之后不再保留原始 IP
+	site, _ := ss.GetSiteCached(eventCreate.SiteID)
+	eventCreate.IP = services.ProtectIP(site, eventCreate.IP)
 
 	// 自动获取User-Agent
 	if eventCreate.UserAgent == "" {
@@ -68,6 +82,18 @@ func (ec *EventController) CreateEvent(c *gin.Context) {
 	}
 
 	event, err := ec.eventService.CreateEvent(&eventCreate)
+	if errors.Is(err, services.ErrDuplicateEvent) {
+		utils.Accepted(c, gin.H{"duplicate": true})
+		return
+	}
+	if errors.Is(err, services.ErrReferrerSpam) {
+		utils.Accepted(c, gin.H{"spam": true})
+		return
+	}
+	if errors.Is(err, services.ErrEventSpooled) {
+		utils.Accepted(c, event)
+		return
+	}
 	if err != nil {
 		utils.Fail(c, err.Error())
 		return
@@ -146,6 +172,10 @@ func (ec *EventController) GetEventsRank(c *gin.Context) {
 		statType = "event_type"
 		eventType = "custom"
 	}
+	// 外链和下载按目标地址排行
+	if eventType == "outbound" || eventType == "download" {
+		statType = eventType
+	}
 	stats, total, err := ec.eventService.GetEventsRankByStats(siteID, dateStr, dateStr, statType, eventType, pageInt, pageSize)
 	if err != nil {
 		utils.ServerError(c, err.Error())
@@ -155,6 +185,158 @@ func (ec *EventController) GetEventsRank(c *gin.Context) {
 	utils.SuccessWithPage(c, stats, total, pageInt, pageSize)
 }
 
+// GetEventProperties 获取自定义事件的属性分布
+func (ec *EventController) GetEventProperties(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	siteID, err := strconv.ParseUint(c.Param("site_id"), 10, 64)
+	if err != nil {
+		utils.ValidationError(c, "无效的站点ID")
+		return
+	}
+	// 验证用户是否有权限访问站点
+	ss := services.NewSiteService()
+	if hasAccess, err := ss.CheckUserAccess(siteID, userID); err != nil || !hasAccess {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+	eventValue := c.Query("event")
+	if eventValue == "" {
+		utils.ValidationError(c, "事件名不能为空")
+		return
+	}
+	// 获取查询日期参数，默认为当天
+	dateStr := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	startDate := c.DefaultQuery("start_date", dateStr)
+	endDate := c.DefaultQuery("end_date", dateStr)
+	pageInt, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || pageInt < 1 {
+		pageInt = 1
+	}
+	pageSize := 10
+
+	stats, total, err := ec.eventService.GetEventProperties(siteID, startDate, endDate, eventValue, c.Query("key"), pageInt, pageSize)
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithPage(c, stats, total, pageInt, pageSize)
+}
+
+// GetRevenue 获取按来源、着陆页或国家归因的收入排行
+func (ec *EventController) GetRevenue(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	siteID, err := strconv.ParseUint(c.Param("site_id"), 10, 64)
+	if err != nil {
+		utils.ValidationError(c, "无效的站点ID")
+		return
+	}
+	// 验证用户是否有权限访问站点
+	ss := services.NewSiteService()
+	if hasAccess, err := ss.CheckUserAccess(siteID, userID); err != nil || !hasAccess {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+	// 获取查询日期参数，默认为当天
+	dateStr := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	startDate := c.DefaultQuery("start_date", dateStr)
+	endDate := c.DefaultQuery("end_date", dateStr)
+	pageInt, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || pageInt < 1 {
+		pageInt = 1
+	}
+	pageSize := 10
+
+	dimension := c.DefaultQuery("dimension", "referrer")
+	if dimension != "referrer" && dimension != "landing" && dimension != "country" {
+		utils.ValidationError(c, "dimension 只能是 referrer、landing 或 country")
+		return
+	}
+
+	stats, total, err := ec.eventService.GetRevenueRank(siteID, startDate, endDate, dimension, pageInt, pageSize)
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithPage(c, stats, total, pageInt, pageSize)
+}
+
+// GetCampaigns 获取广告活动的访客数、跳出率和转化
+func (ec *EventController) GetCampaigns(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	siteID, err := strconv.ParseUint(c.Param("site_id"), 10, 64)
+	if err != nil {
+		utils.ValidationError(c, "无效的站点ID")
+		return
+	}
+	// 验证用户是否有权限访问站点
+	ss := services.NewSiteService()
+	if hasAccess, err := ss.CheckUserAccess(siteID, userID); err != nil || !hasAccess {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+	// 获取查询日期参数，默认为当天
+	dateStr := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	startDate := c.DefaultQuery("start_date", dateStr)
+	endDate := c.DefaultQuery("end_date", dateStr)
+	pageInt, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || pageInt < 1 {
+		pageInt = 1
+	}
+	pageSize := 10
+	groupBy := c.DefaultQuery("group_by", "campaign")
+	if !services.IsCampaignGroup(groupBy) {
+		utils.ValidationError(c, "group_by 只能是 campaign、source、medium、term 或 content")
+		return
+	}
+
+	stats, total, err := ec.eventService.GetCampaigns(siteID, startDate, endDate, groupBy, pageInt, pageSize)
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithPage(c, stats, total, pageInt, pageSize)
+}
+
+// GetPageMetrics 获取各页面的浏览量、平均停留时长和滚动深度
+func (ec *EventController) GetPageMetrics(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	siteID, err := strconv.ParseUint(c.Param("site_id"), 10, 64)
+	if err != nil {
+		utils.ValidationError(c, "无效的站点ID")
+		return
+	}
+	// 验证用户是否有权限访问站点
+	ss := services.NewSiteService()
+	if hasAccess, err := ss.CheckUserAccess(siteID, userID); err != nil || !hasAccess {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+	// 获取查询日期参数，默认为当天
+	dateStr := c.DefaultQuery("date", time.Now().Format("2006-01-02"))
+	startDate := c.DefaultQuery("start_date", dateStr)
+	endDate := c.DefaultQuery("end_date", dateStr)
+	pageInt, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || pageInt < 1 {
+		pageInt = 1
+	}
+	pageSize := 10
+
+	stats, total, err := ec.eventService.GetPageMetrics(siteID, startDate, endDate, pageInt, pageSize)
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+
+	utils.SuccessWithPage(c, stats, total, pageInt, pageSize)
+}
+
 // GetEventsSummary 获取网站下整体流量指标
 func (ec *EventController) GetEventsSummary(c *gin.Context) {
 	userID := middleware.GetCurrentUserID(c)
@@ -184,75 +366,391 @@ func (ec *EventController) GetEventsSummary(c *gin.Context) {
 
 // TrackCustomEvent 自定义事件追踪接口
 func (ec *EventController) TrackCustomEvent(c *gin.Context) {
-	var req struct {
-		SessionID  string `json:"session_id"`
-		UserID     string `json:"user_id"`
-		URL        string `json:"url"`
-		Referrer   string `json:"referrer"`
-		EventType  string `json:"event_type"`
-		EventValue string `json:"event_value"`
-		SiteIDStr  string `json:"site_id"`
-		Screen     string `json:"screen"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
+	var req models.TrackPayload
+	if err := bindTrackPayload(c, &req); err != nil {
 		utils.ValidationError(c, err.Error())
 		return
 	}
-	SiteID, err := strconv.ParseUint(req.SiteIDStr, 10, 64)
+
+	env := newTrackEnv(c)
+	eventCreate, err := env.buildEvent(&req)
+	if errors.Is(err, services.ErrPrivacyOptOut) {
+		utils.Accepted(c, gin.H{"opted_out": true})
+		return
+	}
+	if errors.Is(err, services.ErrTrafficExcluded) {
+		utils.Accepted(c, gin.H{"excluded": true})
+		return
+	}
 	if err != nil {
-		utils.ValidationError(c, "无效的SiteID格式")
+		respondTrackError(c, err)
 		return
 	}
 
-	// 验证站点存在
-	siteService := services.NewSiteService()
-	if _, err = siteService.GetSiteByID(SiteID); err != nil {
-		utils.Fail(c, "站点不存在")
+	// 放入异步队列，由后台协程批量写库
+	err = ec.enqueue(eventCreate)
+	if errors.Is(err, services.ErrDuplicateEvent) {
+		utils.Accepted(c, gin.H{"duplicate": true})
+		return
+	}
+	if err != nil {
+		respondTrackError(c, err)
+		return
+	}
+
+	utils.Accepted(c, nil)
+}
+
+// enqueue 去重后放入异步队列，入队失败时撤销去重记录，使客户端可以重试
+func (ec *EventController) enqueue(eventCreate *models.EventCreate) error {
+	deduper := services.GetDeduper()
+	if deduper != nil {
+		if err := deduper.Check(eventCreate); err != nil {
+			return err
+		}
+	}
+	if err := ec.ingestQueue.Enqueue(eventCreate); err != nil {
+		if deduper != nil {
+			deduper.Forget(eventCreate)
+		}
+		return err
+	}
+	return nil
+}
+
+// respondTrackError 按错误类型返回上报失败响应
+func respondTrackError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrIngestForbidden):
+		utils.FailWithCode(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrRateLimited), errors.Is(err, services.ErrClientBanned):
+		c.Header("Retry-After", "60")
+		utils.FailWithCode(c, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, services.ErrQueueFull):
+		c.Header("Retry-After", "1")
+		utils.FailWithCode(c, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, services.ErrQueueClosed):
+		utils.FailWithCode(c, http.StatusServiceUnavailable, err.Error())
+	default:
+		utils.Fail(c, err.Error())
+	}
+}
+
+// isRetryableTrackError 是否为客户端稍后可重试的错误（限流、队列已满）
+func isRetryableTrackError(err error) bool {
+	return errors.Is(err, services.ErrQueueFull) || errors.Is(err, services.ErrRateLimited) || errors.Is(err, services.ErrClientBanned)
+}
+
+// transparentGIF 1x1 透明 GIF
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// TrackPixel 像素追踪接口，用于无 JS 环境（AMP、noscript、RSS 阅读器、邮件打开）
+// 参数: site_id 站点ID, url 页面地址（为空时取 Referer）, e 事件名（为空时为页面浏览）,
+// ref 来源, sid 会话ID, uid 用户ID, eid 事件ID, props 自定义事件属性（JSON）。无论成功与否都返回透明 GIF，避免页面出现裂图。
+func (ec *EventController) TrackPixel(c *gin.Context) {
+	defer func() {
+		c.Header("Cache-Control", "no-cache, no-store, must-revalidate, max-age=0")
+		c.Header("Pragma", "no-cache")
+		c.Header("Expires", "0")
+		c.Data(http.StatusOK, "image/gif", transparentGIF)
+	}()
+
+	req := models.TrackPayload{
+		SiteIDStr: c.Query("site_id"),
+		SessionID: c.Query("sid"),
+		UserID:    c.Query("uid"),
+		URL:       c.Query("url"),
+		Referrer:  c.Query("ref"),
+		Key:       c.Query("key"),
+		EventID:   c.Query("eid"),
+		EventType: "page_view",
+	}
+	if event := c.Query("e"); event != "" && event != "page_view" {
+		req.EventType = "custom"
+		req.EventValue = event
+		if err := req.Properties.UnmarshalParam(c.Query("props")); err != nil {
+			return
+		}
+	}
+	// 未指定页面时使用嵌入像素的页面地址
+	if req.URL == "" {
+		if u, err := url.Parse(c.Request.Referer()); err == nil && u.Path != "" {
+			req.URL = u.Path
+		}
+	}
+
+	// 没有 JS 就没有本地会话，未传 sid 时由 buildEvent 生成访客ID
+	env := newTrackEnv(c)
+	eventCreate, err := env.buildEvent(&req)
+	if err != nil {
+		return
+	}
+	if err = ec.enqueue(eventCreate); err != nil && !errors.Is(err, services.ErrDuplicateEvent) {
+		log.Printf("像素事件入队失败: %v", err)
+	}
+}
+
+// bindTrackPayload 解析上报参数
+// 兼容 navigator.sendBeacon 发送的 text/plain JSON，以及表单提交（字段平铺或放在 data 字段中的 JSON）
+func bindTrackPayload(c *gin.Context, req *models.TrackPayload) error {
+	switch c.ContentType() {
+	case binding.MIMEPOSTForm, binding.MIMEMultipartPOSTForm:
+		if data := c.PostForm("data"); data != "" {
+			if err := json.Unmarshal([]byte(data), req); err != nil {
+				return errors.New("事件格式错误")
+			}
+			return nil
+		}
+		return c.ShouldBind(req)
+	default:
+		// application/json、text/plain 或未声明类型时按 JSON 解析
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, 64<<10))
+		if err != nil {
+			return errors.New("请求体过大或读取失败")
+		}
+		if err = json.Unmarshal(body, req); err != nil {
+			return errors.New("事件格式错误")
+		}
+		return nil
+	}
+}
+
+// TrackBatchEvents 批量事件追踪接口，支持 JSON 数组和 NDJSON
+func (ec *EventController) TrackBatchEvents(c *gin.Context) {
+	maxBatch := config.GetConfig().Ingest.MaxBatch
+
+	items, err := splitBatchBody(c, int64(maxBatch)*8<<10)
+	if err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+	if len(items) == 0 {
+		utils.ValidationError(c, "事件列表不能为空")
+		return
+	}
+	if len(items) > maxBatch {
+		utils.FailWithCode(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("单次最多上报%d个事件", maxBatch))
 		return
 	}
-	UserAgent := c.GetHeader("User-Agent")
+
+	env := newTrackEnv(c)
+	results := make([]models.TrackResult, len(items))
+	accepted, duplicates, optedOut, excluded := 0, 0, 0, 0
+	var retryErr error
+	for i, item := range items {
+		results[i].Index = i
+
+		var req models.TrackPayload
+		if err = json.Unmarshal(item, &req); err != nil {
+			results[i].Error = "事件格式错误"
+			continue
+		}
+		eventCreate, err := env.buildEvent(&req)
+		if err == nil {
+			err = ec.enqueue(eventCreate)
+		}
+		if errors.Is(err, services.ErrDuplicateEvent) {
+			results[i].OK = true
+			results[i].Duplicate = true
+			duplicates++
+			continue
+		}
+		if errors.Is(err, services.ErrPrivacyOptOut) {
+			results[i].OK = true
+			results[i].OptedOut = true
+			optedOut++
+			continue
+		}
+		if errors.Is(err, services.ErrTrafficExcluded) {
+			results[i].OK = true
+			results[i].Excluded = true
+			excluded++
+			continue
+		}
+		if err != nil {
+			if isRetryableTrackError(err) {
+				retryErr = err
+			}
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].OK = true
+		accepted++
+	}
+
+	// 一个都没接收且是限流或队列已满，整体返回错误状态让客户端重试
+	if accepted == 0 && duplicates == 0 && optedOut == 0 && excluded == 0 && retryErr != nil {
+		respondTrackError(c, retryErr)
+		return
+	}
+
+	utils.Accepted(c, gin.H{
+		"accepted":   accepted,
+		"duplicates": duplicates,
+		"opted_out":  optedOut,
+		"excluded":   excluded,
+		"rejected":   len(items) - accepted - duplicates - optedOut - excluded,
+		"results":    results,
+	})
+}
+
+// splitBatchBody 将批量上报的请求体拆分为单个事件的原始 JSON
+func splitBatchBody(c *gin.Context, maxBytes int64) ([]json.RawMessage, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes))
+	if err != nil {
+		return nil, errors.New("请求体过大或读取失败")
+	}
+	body = bytes.TrimSpace(body)
+
+	// JSON 数组
+	if len(body) > 0 && body[0] == '[' {
+		var items []json.RawMessage
+		if err = json.Unmarshal(body, &items); err != nil {
+			return nil, errors.New("JSON数组格式错误")
+		}
+		return items, nil
+	}
+
+	// NDJSON，每行一个事件
+	var items []json.RawMessage
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		items = append(items, json.RawMessage(line))
+	}
+	return items, nil
+}
+
+// trackEnv 单次追踪请求内共享的客户端信息，批量上报时各事件复用
+type trackEnv struct {
+	ip        string
+	userAgent string
+	origin    string
+	referer   string
+	device    string
+	browser   string
+	os        string
+	isBot     bool
+	ipInfo    *utils.IPInfo
+	optOut    bool   // 浏览器发送了 DNT: 1 或 Sec-GPC: 1
+	ignore    string // “不统计我的访问”Cookie
+	sites     map[uint64]*models.Site
+	limited   map[uint64]error // 各站点本次请求的限流结果，批量上报每个请求只计一次
+}
+
+// newTrackEnv 解析请求的IP、UserAgent和地理位置
+func newTrackEnv(c *gin.Context) *trackEnv {
+	env := &trackEnv{
+		ip:        utils.GetRealIPWithTrust(c, config.GetConfig().Server.TrustedProxies, config.GetConfig().Server.ClientIPHeader),
+		userAgent: c.GetHeader("User-Agent"),
+		origin:    c.GetHeader("Origin"),
+		referer:   c.Request.Referer(),
+		optOut:    c.GetHeader("DNT") == "1" || c.GetHeader("Sec-GPC") == "1",
+		sites:     make(map[uint64]*models.Site),
+		limited:   make(map[uint64]error),
+	}
 	// 从UserAgent中提取Device、Browser、OS、IsBot
-	device, browser, os, isBot := utils.ParseUserAgent(UserAgent)
-	ip := utils.GetRealIP(c)
-	// 从ip提取国家等信息
-	ipInfo, err := utils.QueryIP(ip)
+	env.ignore, _ = c.Cookie(services.IgnoreCookieName)
+	env.device, env.browser, env.os, env.isBot = utils.ParseUserAgent(env.userAgent)
+	// 从截断后的ip提取国家等信息，原始 IP 只用于限流、排除规则和无 Cookie 访客ID
+	env.ipInfo = services.LookupGeo(env.ip)
+	return env
+}
+
+// buildEvent 校验上报参数并补全客户端信息
+func (env *trackEnv) buildEvent(req *models.TrackPayload) (*models.EventCreate, error) {
+	SiteID, err := strconv.ParseUint(req.SiteIDStr, 10, 64)
 	if err != nil {
-		log.Println(err)
+		return nil, errors.New("无效的SiteID格式")
+	}
+
+	// 验证站点存在
+	site, checked := env.sites[SiteID]
+	if !checked {
+		siteService := services.NewSiteService()
+		site, _ = siteService.GetSiteCached(SiteID)
+		env.sites[SiteID] = site
+	}
+	if site == nil {
+		return nil, errors.New("站点不存在")
+	}
+	// 校验采集密钥和来源域名
+	if err = services.CheckIngestAccess(site, req.Key, env.origin, env.referer, req.URL); err != nil {
+		return nil, err
 	}
+	// 站点排除的 IP 段、Cookie 和页面路径
+	if services.IsExcludedTraffic(site, env.ip, req.URL, env.ignore) {
+		return nil, services.ErrTrafficExcluded
+	}
+	// 限流，同一请求中的事件共用一次结果，批量上报不会因事件数多而超限或被封禁
+	if limiter := services.GetIngestLimiter(); limiter != nil {
+		limitErr, checked := env.limited[SiteID]
+		if !checked {
+			limitErr = limiter.Allow(SiteID, env.ip)
+			env.limited[SiteID] = limitErr
+		}
+		if limitErr != nil {
+			return nil, limitErr
+		}
+	}
+
 	// 处理设备类型
+	device := env.device
 	if req.Screen != "" {
-		deviceBak := utils.DetectDevice(UserAgent, req.Screen)
+		deviceBak := utils.DetectDevice(env.userAgent, req.Screen)
 		if deviceBak != "Unknown" {
 			device = deviceBak
 		}
 	}
+	// 无 Cookie 模式或客户端未提供会话ID时，由服务端生成当天有效的访客ID
+	sessionID := req.SessionID
+	if site.Cookieless || sessionID == "" {
+		sessionID = services.VisitorID(SiteID, env.ip, env.userAgent)
+	}
 	eventCreate := &models.EventCreate{
 		SiteID:      SiteID,
-		SessionID:   req.SessionID,
+		SessionID:   sessionID,
 		UserID:      req.UserID,
-		IP:          ip,
+		IP:          services.ProtectIP(site, env.ip),
 		URL:         req.URL,
 		Referrer:    req.Referrer,
 		Screen:      req.Screen,
 		Device:      device,
-		Browser:     browser,
-		OS:          os,
-		IsBot:       isBot,
-		Country:     ipInfo.Country,
-		Subdivision: ipInfo.Region,
-		City:        ipInfo.City,
-		Isp:         ipInfo.ISP,
-		UserAgent:   UserAgent,
+		Browser:     env.browser,
+		OS:          env.os,
+		IsBot:       env.isBot,
+		Country:     env.ipInfo.Country,
+		Subdivision: env.ipInfo.Region,
+		City:        env.ipInfo.City,
+		Isp:         env.ipInfo.ISP,
+		CountryCode: env.ipInfo.CountryCode,
+		RegionCode:  env.ipInfo.RegionCode,
+		ASN:         env.ipInfo.ASN,
+		UserAgent:   env.userAgent,
 		EventType:   req.EventType,
 		EventValue:  req.EventValue,
+		EventID:     req.EventID,
+		Properties:  req.Properties,
+		Amount:      req.Amount,
+		Currency:    req.Currency,
+		Query:       req.Query,
+		EngagedTime: req.EngagedTime,
+		ScrollDepth: req.ScrollDepth,
 	}
-
-	event, err := ec.eventService.CreateEvent(eventCreate)
-	if err != nil {
-		utils.Fail(c, err.Error())
-		return
+	// 访客拒绝追踪时按站点设置丢弃或匿名记录
+	if env.optOut {
+		if err = services.ApplyPrivacySignal(site, eventCreate); err != nil {
+			return nil, err
+		}
 	}
-
-	utils.Success(c, event)
+	if err = services.ValidateEventCreate(eventCreate); err != nil {
+		return nil, err
+	}
+	return eventCreate, nil
 }
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"net/http"
 	"strconv"
 
 	"pingoo/middleware"
@@ -39,14 +40,7 @@ func (sc *SiteController) Create(c *gin.Context) {
 	}
 
 	// 返回站点信息
-	siteResponse := models.SiteResponse{
-		ID:        uint64(site.ID),
-		Name:      site.Name,
-		Domain:    site.Domain,
-		UserID:    site.UserID,
-		CreatedAt: site.CreatedAt,
-		UpdatedAt: site.UpdatedAt,
-	}
+	siteResponse := newSiteResponse(site)
 
 	utils.Success(c, siteResponse)
 }
@@ -74,14 +68,7 @@ func (sc *SiteController) List(c *gin.Context) {
 	// 转换为响应格式
 	var siteResponses []models.SiteResponse
 	for _, site := range sites {
-		siteResponses = append(siteResponses, models.SiteResponse{
-			ID:        uint64(site.ID),
-			Name:      site.Name,
-			Domain:    site.Domain,
-			UserID:    site.UserID,
-			CreatedAt: site.CreatedAt,
-			UpdatedAt: site.UpdatedAt,
-		})
+		siteResponses = append(siteResponses, newSiteResponse(&site))
 	}
 
 	utils.SuccessWithPage(c, siteResponses, total, page, limit)
@@ -108,14 +95,7 @@ func (sc *SiteController) Get(c *gin.Context) {
 	}
 
 	// 返回站点信息
-	siteResponse := models.SiteResponse{
-		ID:        uint64(site.ID),
-		Name:      site.Name,
-		Domain:    site.Domain,
-		UserID:    site.UserID,
-		CreatedAt: site.CreatedAt,
-		UpdatedAt: site.UpdatedAt,
-	}
+	siteResponse := newSiteResponse(site)
 
 	utils.Success(c, siteResponse)
 }
@@ -142,14 +122,7 @@ func (sc *SiteController) Update(c *gin.Context) {
 		return
 	}
 
-	siteResponse := models.SiteResponse{
-		ID:        uint64(site.ID),
-		Name:      site.Name,
-		Domain:    site.Domain,
-		UserID:    site.UserID,
-		CreatedAt: site.CreatedAt,
-		UpdatedAt: site.UpdatedAt,
-	}
+	siteResponse := newSiteResponse(site)
 
 	utils.Success(c, siteResponse)
 }
@@ -173,6 +146,103 @@ func (sc *SiteController) Delete(c *gin.Context) {
 	utils.Success(c, "站点删除成功")
 }
 
+// RegenerateIngestKey 重新生成站点采集密钥
+func (sc *SiteController) RegenerateIngestKey(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	siteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.ValidationError(c, "无效的站点ID")
+		return
+	}
+
+	site, err := sc.siteService.RegenerateIngestKey(siteID, userID)
+	if err != nil {
+		utils.ServerError(c, "生成采集密钥失败")
+		return
+	}
+
+	utils.Success(c, newSiteResponse(site))
+}
+
+// IngestStats 获取站点上报限流统计
+func (sc *SiteController) IngestStats(c *gin.Context) {
+	userID := middleware.GetCurrentUserID(c)
+
+	siteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.ValidationError(c, "无效的站点ID")
+		return
+	}
+	if hasAccess, err := sc.siteService.CheckUserAccess(siteID, userID); err != nil || !hasAccess {
+		utils.ValidationError(c, "站点不存在")
+		return
+	}
+
+	var dropped services.DroppedStats
+	limiter := services.GetIngestLimiter()
+	if limiter != nil {
+		dropped = limiter.Dropped(siteID)
+	}
+
+	utils.Success(c, gin.H{
+		"rate_limit_enabled": limiter != nil,
+		"dropped":            dropped,
+	})
+}
+
+// IgnoreMe 在当前浏览器设置“不统计我的访问”Cookie，之后该浏览器对站点的访问不再记录
+func (sc *SiteController) IgnoreMe(c *gin.Context) {
+	sc.setIgnoreCookie(c, true)
+}
+
+// UnignoreMe 清除当前浏览器的“不统计我的访问”设置
+func (sc *SiteController) UnignoreMe(c *gin.Context) {
+	sc.setIgnoreCookie(c, false)
+}
+
+func (sc *SiteController) setIgnoreCookie(c *gin.Context, ignore bool) {
+	userID := middleware.GetCurrentUserID(c)
+
+	siteID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.ValidationError(c, "无效的站点ID")
+		return
+	}
+	if hasAccess, err := sc.siteService.CheckUserAccess(siteID, userID); err != nil || !hasAccess {
+		utils.ValidationError(c, "站点不存在")
+		return
+	}
+
+	value, _ := c.Cookie(services.IgnoreCookieName)
+	if ignore {
+		value = services.AddIgnoredSite(value, siteID)
+	} else {
+		value = services.RemoveIgnoredSite(value, siteID)
+	}
+	// 统计脚本跨站上报时也要带上 Cookie，HTTPS 下使用 SameSite=None；HTTP 下跨站上报不会带上 Cookie，只能由访客在网站上调用 pingoo.optOut()
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	sameSite := http.SameSiteLaxMode
+	if secure {
+		sameSite = http.SameSiteNoneMode
+	}
+	maxAge := 365 * 24 * 3600
+	if value == "" {
+		maxAge = -1
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     services.IgnoreCookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HttpOnly: true,
+		SameSite: sameSite,
+	})
+
+	utils.Success(c, gin.H{"ignored": ignore})
+}
+
 // ClearStats 删除网站所有统计数据
 func (sc *SiteController) ClearStats(c *gin.Context) {
 	userID := middleware.GetCurrentUserID(c)
@@ -191,3 +261,37 @@ func (sc *SiteController) ClearStats(c *gin.Context) {
 
 	utils.Success(c, gin.H{"message": "统计数据已清空"})
 }
+
+// newSiteResponse 转换为站点响应结构
+func newSiteResponse(site *models.Site) models.SiteResponse {
+	response := models.SiteResponse{
+		ID:             uint64(site.ID),
+		Name:           site.Name,
+		Domain:         site.Domain,
+		UserID:         site.UserID,
+		CreatedAt:      site.CreatedAt,
+		UpdatedAt:      site.UpdatedAt,
+		IngestKey:      site.IngestKey,
+		AllowedOrigins: site.AllowedOrigins,
+		StrictOrigin:   site.StrictOrigin,
+		Currency:       services.SiteCurrency(site),
+
+		BlockedReferrers:   site.BlockedReferrers,
+		PrivacySignal:      services.SitePrivacySignal(site),
+		Cookieless:         site.Cookieless,
+		IPMode:             services.SiteIPMode(site),
+		IPv4Prefix:         site.IPv4Prefix,
+		IPv6Prefix:         site.IPv6Prefix,
+		ExcludedIPs:        site.ExcludedIPs,
+		ExcludedPaths:      site.ExcludedPaths,
+		TrackSPA:           site.TrackSPA,
+		TrackHash:          site.TrackHash,
+		TrackOutbound:      site.TrackOutbound,
+		TrackDownloads:     site.TrackDownloads,
+		DownloadExtensions: site.DownloadExtensions,
+	}
+	if script, err := services.SiteTrackerScript(site); err == nil {
+		response.TrackerHash = script.Hash
+	}
+	return response
+}
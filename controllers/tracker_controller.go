@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pingoo/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrackerController 追踪脚本控制器
+type TrackerController struct {
+	siteService *services.SiteService
+}
+
+// NewTrackerController 创建追踪脚本控制器
+func NewTrackerController() *TrackerController {
+	return &TrackerController{siteService: services.NewSiteService()}
+}
+
+// Script 返回追踪脚本：带 site 参数时返回按站点设置生成的脚本，否则返回通用脚本。
+// 地址带与内容哈希一致的 v 参数时长期缓存，否则短时间缓存并通过 ETag 校验
+func (tc *TrackerController) Script(c *gin.Context) {
+	var script *services.TrackerScript
+	var err error
+	if siteParam := c.Query("site"); siteParam != "" {
+		siteID, parseErr := strconv.ParseUint(siteParam, 10, 64)
+		if parseErr != nil {
+			c.String(http.StatusBadRequest, "// 无效的站点ID")
+			return
+		}
+		site, _ := tc.siteService.GetSiteCached(siteID)
+		if site == nil {
+			c.String(http.StatusNotFound, "// 站点不存在")
+			return
+		}
+		script, err = services.SiteTrackerScript(site)
+	} else {
+		script, err = services.GenericTrackerScript()
+	}
+	if err != nil {
+		log.Printf("生成追踪脚本失败: %v", err)
+		c.String(http.StatusInternalServerError, "// 生成追踪脚本失败")
+		return
+	}
+
+	if c.Query("v") == script.Hash {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "public, max-age=300")
+	}
+	c.Header("ETag", script.ETag())
+	if etagMatches(c.GetHeader("If-None-Match"), script.ETag()) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/javascript; charset=utf-8", script.Body)
+}
+
+// etagMatches If-None-Match 请求头是否包含指定 ETag，按弱比较处理
+func etagMatches(header, etag string) bool {
+	for _, item := range strings.Split(header, ",") {
+		item = strings.TrimPrefix(strings.TrimSpace(item), "W/")
+		if item == "*" || item == etag {
+			return true
+		}
+	}
+	return false
+}
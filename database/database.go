@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"pingoo/config"
 	"sync"
@@ -55,3 +56,15 @@ func Initialize(config config.DatabaseConfig) (*gorm.DB, error) {
 func GetDB() *gorm.DB {
 	return DB
 }
+
+// Ping 检查数据库连接是否可用
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return fmt.Errorf("数据库未初始化")
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
@@ -18,6 +18,8 @@ func Migrate() error {
 		&models.Event{},
 		&models.Session{},
 		&models.DailyStats{},
+		&models.DailyRevenue{},
+		&models.VisitorSalt{},
 	); err != nil {
 		return fmt.Errorf("数据库迁移失败: %v", err)
 	}
@@ -105,5 +107,12 @@ func addIndexes(db *gorm.DB) error {
 		}
 	}
 
+	// 检查并创建daily_revenue表索引
+	if !db.Migrator().HasIndex("daily_revenue", "uniq_daily_revenue") {
+		if err := db.Exec("CREATE UNIQUE INDEX uniq_daily_revenue ON daily_revenue (site_id, date, dimension, item)").Error; err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
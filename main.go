@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
 	"pingoo/config"
 	"pingoo/database"
 	"pingoo/routers"
+	"pingoo/services"
+	"pingoo/utils"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +27,12 @@ func main() {
 	loc, _ := time.LoadLocation(cfg.Database.TimeZone)
 	time.Local = loc
 
+	// 命令行子命令
+	if len(os.Args) > 1 && os.Args[1] == "spool" {
+		runSpoolCommand(cfg, os.Args[2:])
+		return
+	}
+
 	// 初始化数据库
 	db, err := database.Initialize(cfg.Database)
 	if err != nil {
@@ -30,22 +45,126 @@ func main() {
 		log.Fatal("数据库迁移失败:", err)
 	}
 
+	// 加载 IP 地理位置数据库，加载失败时不记录地理位置，文件修改后自动重新加载
+	geoDB, err := services.InitGeoDatabase(cfg.Geo)
+	if err != nil {
+		log.Println("加载IP地理位置数据库失败:", err)
+	}
+
+	// 加载流量渠道规则
+	if err := utils.LoadChannelRules(cfg.Traffic.ChannelRulesFile); err != nil {
+		log.Fatal("加载渠道规则失败:", err)
+	}
+
+	// 加载来源垃圾域名列表，文件修改后自动重新加载
+	blocklist, err := services.InitReferrerBlocklist(cfg.Traffic)
+	if err != nil {
+		log.Fatal("加载垃圾来源列表失败:", err)
+	}
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	services.StartBlocklistReloader(reloadCtx, blocklist, cfg.Traffic.SpamReloadInterval)
+	services.StartGeoReloader(reloadCtx, geoDB, cfg.Geo.ReloadInterval)
+
+	// 打开本地暂存区，数据库恢复后自动回放
+	spool, err := services.InitSpool(cfg.Spool)
+	if err != nil {
+		log.Fatal("打开暂存区失败:", err)
+	}
+	replayCtx, stopReplay := context.WithCancel(context.Background())
+	services.StartSpoolReplayer(replayCtx, spool, cfg.Spool.ReplayInterval)
+
+	// 上报接口限流
+	services.InitIngestLimiter(cfg.Limit)
+	// 重复上报去重
+	services.InitDeduper(cfg.Ingest)
+	// 无 Cookie 访客ID的盐值每日更换
+	saltCtx, stopSalt := context.WithCancel(context.Background())
+	services.StartSaltRotator(saltCtx)
+
+	// 启动事件异步写入队列
+	ingestQueue := services.InitIngestQueue(cfg.Ingest)
+
 	// 设置Gin模式
 	gin.SetMode(cfg.Server.Mode)
 
-	// 创建Gin引擎
-	r := gin.Default()
-
-	// 配置静态文件服务
-	r.Static("/public", "./public")
+	// 创建Gin引擎，日志和恢复中间件在 SetupRouter 中注册
+	r := gin.New()
+	// 只信任配置的代理发送的客户端IP请求头，与上报接口的IP解析保持一致
+	r.RemoteIPHeaders = []string{cfg.Server.ClientIPHeader}
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("信任代理配置错误:", err)
+	}
 
 	// 初始化路由
 	routers.SetupRouter(r, db, cfg)
 
+	// 配置静态文件服务
+	r.Static("/public", "./public")
+
 	// 启动服务器
 	port := cfg.Server.Port
-	log.Printf("服务器启动在端口: %s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("服务器启动失败:", err)
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		log.Printf("服务器启动在端口: %s", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("服务器启动失败:", err)
+		}
+	}()
+
+	// 等待退出信号，先停止接收请求，再把队列中的事件写完
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Println("正在关闭服务器...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("服务器关闭失败:", err)
+	}
+	if err := ingestQueue.Close(shutdownCtx); err != nil {
+		log.Println("事件队列未能完全写入:", err)
+	}
+	stopReplay()
+	stopReload()
+	stopSalt()
+	spool.Close()
+	log.Println("服务器已退出")
+}
+
+// runSpoolCommand 查看或清空本地暂存区
+// 用法: pingoo spool inspect | pingoo spool purge
+func runSpoolCommand(cfg *config.Config, args []string) {
+	spool, err := services.OpenSpool(cfg.Spool.Dir, cfg.Spool.SegmentSize)
+	if err != nil {
+		log.Fatal("打开暂存区失败:", err)
+	}
+	defer spool.Close()
+
+	action := "inspect"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	switch action {
+	case "inspect":
+		segments, err := spool.Segments()
+		if err != nil {
+			log.Fatal("读取暂存区失败:", err)
+		}
+		stats := spool.Stats()
+		fmt.Printf("暂存目录: %s\n分段数: %d  事件数: %d  大小: %d 字节\n", cfg.Spool.Dir, stats.Segments, stats.Records, stats.Bytes)
+		for _, seg := range segments {
+			fmt.Printf("%s  %8d 条  %10d 字节  %s ~ %s\n", seg.Name, seg.Records, seg.Size,
+				seg.First.Format("2006-01-02 15:04:05"), seg.Last.Format("2006-01-02 15:04:05"))
+		}
+	case "purge":
+		stats := spool.Stats()
+		if err := spool.Purge(); err != nil {
+			log.Fatal("清空暂存区失败:", err)
+		}
+		fmt.Printf("已清空暂存区，删除 %d 个分段、%d 条事件\n", stats.Segments, stats.Records)
+	default:
+		fmt.Println("用法: pingoo spool [inspect|purge]")
+		os.Exit(2)
 	}
 }
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"pingoo/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Logger 请求日志中间件，格式与 gin.Logger 相同，但客户端 IP 截断后再输出，日志中不出现原始 IP
+func Logger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		clientIP, err := utils.AnonymizeIP(param.ClientIP)
+		if err != nil {
+			clientIP = "-"
+		}
+		if param.Latency > time.Minute {
+			param.Latency = param.Latency.Truncate(time.Second)
+		}
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			param.StatusCode,
+			param.Latency,
+			clientIP,
+			param.Method,
+			param.Path,
+			param.ErrorMessage,
+		)
+	})
+}
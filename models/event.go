@@ -1,6 +1,10 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
 	"gorm.io/gorm"
 )
 
@@ -22,8 +26,37 @@ type Event struct {
 	Subdivision string `gorm:"type:varchar(32);index" json:"subdivision"` // 省份
 	City        string `gorm:"type:varchar(32);index" json:"city"`        // 城市
 	ISP         string `gorm:"type:varchar(32);index" json:"isp"`         // 运营商
+	CountryCode string `gorm:"type:varchar(2);index" json:"country_code"` // ISO 国家代码
+	RegionCode  string `gorm:"type:varchar(8)" json:"region_code"`        // ISO 地区代码
+	ASN         uint   `gorm:"default:0" json:"asn"`                      // 自治系统号
 	EventType   string `gorm:"type:varchar(32);index" json:"event_type"`  // 事件类型
 	EventValue  string `gorm:"type:text" json:"event_value"`              // 事件值
+	IsSpam      bool   `gorm:"type:boolean;default:false" json:"is_spam"` // 来源为垃圾域名，不计入统计
+	EventID     string `gorm:"type:varchar(64);index" json:"event_id"`    // 客户端事件ID，用于去重
+
+	Properties EventProperties `gorm:"type:jsonb;index:idx_events_properties,type:gin" json:"properties,omitempty"` // 自定义属性
+
+	// 广告活动（UTM 参数和点击ID）
+	UTMSource   string `gorm:"type:varchar(255);index" json:"utm_source,omitempty"`   // 来源
+	UTMMedium   string `gorm:"type:varchar(255)" json:"utm_medium,omitempty"`         // 媒介
+	UTMCampaign string `gorm:"type:varchar(255);index" json:"utm_campaign,omitempty"` // 活动名称
+	UTMTerm     string `gorm:"type:varchar(255)" json:"utm_term,omitempty"`           // 关键词
+	UTMContent  string `gorm:"type:varchar(255)" json:"utm_content,omitempty"`        // 广告内容
+	ClickIDType string `gorm:"type:varchar(16)" json:"click_id_type,omitempty"`       // 点击ID类型，如 gclid、fbclid
+	ClickID     string `gorm:"type:varchar(255)" json:"click_id,omitempty"`           // 点击ID
+
+	// 流量渠道，站内跳转为空
+	Channel string `gorm:"type:varchar(32);index" json:"channel,omitempty"` // 渠道，如 Organic Search、Social
+	Source  string `gorm:"type:varchar(100)" json:"source,omitempty"`       // 规范来源名，如 Google
+
+	// 购买事件（event_type = purchase）
+	Amount   float64 `gorm:"type:numeric(18,4);default:0" json:"amount,omitempty"`  // 订单金额（原始货币）
+	Currency string  `gorm:"type:varchar(3)" json:"currency,omitempty"`             // 订单货币
+	Revenue  float64 `gorm:"type:numeric(18,4);default:0" json:"revenue,omitempty"` // 换算为站点报表货币后的收入
+
+	// 页面浏览的互动数据，由追踪脚本的 engagement 事件更新，未上报时为 NULL
+	EngagedTime *int `json:"engaged_time,omitempty"` // 页面在前台的停留时长（秒）
+	ScrollDepth *int `json:"scroll_depth,omitempty"` // 最大滚动深度（%）
 
 	// 关联关系
 	Site Site `gorm:"foreignKey:SiteID" json:"site,omitempty"`
@@ -34,6 +67,46 @@ func (Event) TableName() string {
 	return "events"
 }
 
+// EventProperties 事件自定义属性，值只能是字符串、数字或布尔值，以 JSONB 存储
+type EventProperties map[string]interface{}
+
+// Value 实现 driver.Valuer
+func (p EventProperties) Value() (driver.Value, error) {
+	if len(p) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan 实现 sql.Scanner
+func (p *EventProperties) Scan(value interface{}) error {
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return errors.New("无效的事件属性类型")
+	}
+	return json.Unmarshal(b, p)
+}
+
+// UnmarshalParam 表单和查询参数中的属性为 JSON 字符串
+func (p *EventProperties) UnmarshalParam(param string) error {
+	if param == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(param), p)
+}
+
 // EventCreate 创建事件的结构体
 type EventCreate struct {
 	SiteID      uint64 `json:"site_id" binding:"required"` // 站点ID
@@ -52,8 +125,54 @@ type EventCreate struct {
 	Subdivision string `json:"subdivision"`
 	City        string `json:"city"`
 	Isp         string `json:"isp"`
+	CountryCode string `json:"country_code"`
+	RegionCode  string `json:"region_code"`
+	ASN         uint   `json:"asn"`
 	EventType   string `json:"event_type" binding:"required"`
 	EventValue  string `json:"event_value"`
+	EventID     string `json:"event_id"` // 客户端生成的事件ID，重试时保持不变
+
+	Properties EventProperties `json:"properties"` // 自定义属性，如 {"plan":"pro","amount":49}
+	Amount     float64         `json:"amount"`     // 购买事件的订单金额
+	Currency   string          `json:"currency"`   // 订单货币，为空时使用站点报表货币
+	Query      string          `json:"query"`      // 页面查询字符串，用于提取 UTM 参数和点击ID
+
+	EngagedTime int `json:"engaged_time"` // engagement 事件：页面在前台的累计停留时长（秒）
+	ScrollDepth int `json:"scroll_depth"` // engagement 事件：最大滚动深度（%）
+
+	Anonymous bool `json:"anonymous"` // 匿名记录：不关联会话和用户，此时 session_id 可以为空
+}
+
+// TrackPayload 追踪接口（/send）上报的事件
+type TrackPayload struct {
+	SessionID  string `json:"session_id" form:"session_id"`
+	UserID     string `json:"user_id" form:"user_id"`
+	URL        string `json:"url" form:"url"`
+	Referrer   string `json:"referrer" form:"referrer"`
+	EventType  string `json:"event_type" form:"event_type"`
+	EventValue string `json:"event_value" form:"event_value"`
+	SiteIDStr  string `json:"site_id" form:"site_id"`
+	Screen     string `json:"screen" form:"screen"`
+	Key        string `json:"key" form:"key"`           // 站点采集密钥
+	EventID    string `json:"event_id" form:"event_id"` // 客户端事件ID，用于去重
+
+	Properties EventProperties `json:"properties" form:"properties"` // 自定义属性，表单上报时为 JSON 字符串
+	Amount     float64         `json:"amount" form:"amount"`         // 购买事件的订单金额
+	Currency   string          `json:"currency" form:"currency"`     // 订单货币
+	Query      string          `json:"query" form:"query"`           // 页面查询字符串（location.search）
+
+	EngagedTime int `json:"engaged_time" form:"engaged_time"` // engagement 事件的累计停留时长（秒）
+	ScrollDepth int `json:"scroll_depth" form:"scroll_depth"` // engagement 事件的最大滚动深度（%）
+}
+
+// TrackResult 批量上报中单个事件的处理结果
+type TrackResult struct {
+	Index     int    `json:"index"`
+	OK        bool   `json:"ok"`
+	Duplicate bool   `json:"duplicate,omitempty"` // 重复事件，已忽略
+	OptedOut  bool   `json:"opted_out,omitempty"` // 访客开启了 DNT/GPC，按站点设置丢弃
+	Excluded  bool   `json:"excluded,omitempty"`  // 命中站点排除规则，已丢弃
+	Error     string `json:"error,omitempty"`
 }
 
 // EventQuery 查询事件的结构体
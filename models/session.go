@@ -17,6 +17,21 @@ type Session struct {
 	EndTime    time.Time `gorm:"column:end_time;comment:会话结束时间"`                             // 会话结束时间
 	Pages      int       `gorm:"column:pages;comment:本次访问的页面数"`                              // 本次访问的页面数
 	Duration   int       `gorm:"column:duration;comment:本次访问的总时长（秒）"`                        // 本次访问的总时长（秒）
+
+	// 追踪脚本上报的互动数据
+	EngagedTime int `gorm:"column:engaged_time;default:0;comment:页面在前台的停留时长（秒）"` // 各页面在前台的停留时长之和（秒）
+
+	// 入口信息，用于收入归因
+	EntryURL string `gorm:"column:entry_url;type:text;comment:着陆页"`         // 着陆页
+	Referrer string `gorm:"column:referrer;type:varchar(255);comment:来源域名"` // 来源域名
+	Country  string `gorm:"column:country;type:varchar(32);comment:国家"`     // 国家
+
+	// 入口的广告活动参数
+	UTMSource   string `gorm:"column:utm_source;type:varchar(255);comment:UTM来源"`    // UTM来源
+	UTMMedium   string `gorm:"column:utm_medium;type:varchar(255);comment:UTM媒介"`    // UTM媒介
+	UTMCampaign string `gorm:"column:utm_campaign;type:varchar(255);comment:UTM活动"`  // UTM活动
+	UTMTerm     string `gorm:"column:utm_term;type:varchar(255);comment:UTM关键词"`     // UTM关键词
+	UTMContent  string `gorm:"column:utm_content;type:varchar(255);comment:UTM广告内容"` // UTM广告内容
 }
 
 // TableName 设置表名
@@ -24,6 +39,18 @@ func (Session) TableName() string {
 	return "sessions"
 }
 
+// VisitorSalt 无 Cookie 访客ID使用的每日盐值，只保留当天的记录
+type VisitorSalt struct {
+	Day       string    `gorm:"column:day;type:varchar(10);primaryKey;comment:日期"` // 日期，如 2025-09-25
+	Salt      string    `gorm:"column:salt;type:varchar(64);not null;comment:盐值"`  // 随机盐值
+	CreatedAt time.Time `gorm:"column:created_at"`
+}
+
+// TableName 设置表名
+func (VisitorSalt) TableName() string {
+	return "visitor_salts"
+}
+
 // SessionCreate 创建会话的请求结构体
 type SessionCreate struct {
 	SessionID string `json:"session_id" binding:"required"`
@@ -13,6 +13,34 @@ type Site struct {
 	Name       string `gorm:"type:varchar(100);not null" json:"name"`
 	Domain     string `gorm:"type:varchar(255);uniqueIndex;not null" json:"domain"`
 
+	// 上报校验
+	IngestKey      string `gorm:"type:varchar(64)" json:"ingest_key"` // 公开采集密钥，为空时不校验
+	AllowedOrigins string `gorm:"type:text" json:"allowed_origins"`   // 允许上报的来源域名，逗号分隔，为空时使用 Domain
+	StrictOrigin   bool   `gorm:"default:false" json:"strict_origin"` // 严格模式：必须携带来源且匹配，否则只拒绝不匹配的来源
+
+	Currency string `gorm:"type:varchar(3)" json:"currency"` // 收入报表货币，为空时使用 REVENUE_DEFAULT_CURRENCY
+
+	BlockedReferrers string `gorm:"type:text" json:"blocked_referrers"` // 额外屏蔽的来源域名，逗号分隔，与全局垃圾来源列表一起生效
+
+	PrivacySignal string `gorm:"type:varchar(16);default:'ignore'" json:"privacy_signal"` // 访客开启 DNT/GPC 时的处理方式：ignore、drop、anonymous
+	Cookieless    bool   `gorm:"default:false" json:"cookieless"`                         // 由服务端按每日盐值、IP 和 UA 生成访客ID，忽略客户端会话ID
+
+	// IP 存储方式，同时作用于 events.ip 和 sessions.ip
+	IPMode     string `gorm:"type:varchar(16);default:'truncate'" json:"ip_mode"` // truncate 截断、drop 不保存、hash 密钥哈希
+	IPv4Prefix int    `gorm:"default:24" json:"ipv4_prefix"`                      // truncate 模式下 IPv4 保留的前缀位数，最多 24
+	IPv6Prefix int    `gorm:"default:64" json:"ipv6_prefix"`                      // truncate 模式下 IPv6 保留的前缀位数，最多 64
+
+	// 排除规则，命中的访问不记录
+	ExcludedIPs   string `gorm:"type:text" json:"excluded_ips"`   // 排除的 IP 或 CIDR 网段，逗号分隔
+	ExcludedPaths string `gorm:"type:text" json:"excluded_paths"` // 排除的页面路径，逗号分隔，支持 /admin/* 前缀匹配
+
+	// 追踪脚本功能，写入按站点生成的脚本
+	TrackSPA           bool   `gorm:"default:true" json:"track_spa"`        // 记录单页应用的路由切换
+	TrackHash          bool   `gorm:"default:false" json:"track_hash"`      // 页面地址包含 hash 路由
+	TrackOutbound      bool   `gorm:"default:false" json:"track_outbound"`  // 自动记录指向站点域名以外的链接点击
+	TrackDownloads     bool   `gorm:"default:false" json:"track_downloads"` // 自动记录文件下载链接的点击
+	DownloadExtensions string `gorm:"type:text" json:"download_extensions"` // 下载文件扩展名，逗号分隔，为空时使用脚本内置列表
+
 	// 关联关系
 	User   User    `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	Events []Event `gorm:"foreignKey:SiteID" json:"events,omitempty"`
@@ -29,10 +57,29 @@ type SiteCreate struct {
 	Domain string `json:"domain" binding:"required,url"`
 }
 
-// SiteUpdate 更新站点结构体
+// SiteUpdate 更新站点结构体，设置项为 nil 时保持不变
 type SiteUpdate struct {
 	Name   string `json:"name" binding:"max=100"`
 	Domain string `json:"domain" binding:"required,url"`
+
+	IngestKey      *string `json:"ingest_key" binding:"omitempty,max=64"`
+	AllowedOrigins *string `json:"allowed_origins"`
+	StrictOrigin   *bool   `json:"strict_origin"`
+	Currency       *string `json:"currency" binding:"omitempty,len=3"`
+
+	BlockedReferrers   *string `json:"blocked_referrers"`
+	PrivacySignal      *string `json:"privacy_signal" binding:"omitempty,oneof=ignore drop anonymous"`
+	Cookieless         *bool   `json:"cookieless"`
+	IPMode             *string `json:"ip_mode" binding:"omitempty,oneof=truncate drop hash"`
+	IPv4Prefix         *int    `json:"ipv4_prefix" binding:"omitempty,min=0,max=24"`
+	IPv6Prefix         *int    `json:"ipv6_prefix" binding:"omitempty,min=0,max=64"`
+	ExcludedIPs        *string `json:"excluded_ips"`
+	ExcludedPaths      *string `json:"excluded_paths"`
+	TrackSPA           *bool   `json:"track_spa"`
+	TrackHash          *bool   `json:"track_hash"`
+	TrackOutbound      *bool   `json:"track_outbound"`
+	TrackDownloads     *bool   `json:"track_downloads"`
+	DownloadExtensions *string `json:"download_extensions"`
 }
 
 // SiteResponse 站点响应结构体
@@ -44,6 +91,26 @@ type SiteResponse struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
+	IngestKey      string `json:"ingest_key"`
+	AllowedOrigins string `json:"allowed_origins"`
+	StrictOrigin   bool   `json:"strict_origin"`
+	Currency       string `json:"currency"`
+
+	BlockedReferrers   string `json:"blocked_referrers"`
+	PrivacySignal      string `json:"privacy_signal"`
+	Cookieless         bool   `json:"cookieless"`
+	IPMode             string `json:"ip_mode"`
+	IPv4Prefix         int    `json:"ipv4_prefix"`
+	IPv6Prefix         int    `json:"ipv6_prefix"`
+	ExcludedIPs        string `json:"excluded_ips"`
+	ExcludedPaths      string `json:"excluded_paths"`
+	TrackSPA           bool   `json:"track_spa"`
+	TrackHash          bool   `json:"track_hash"`
+	TrackOutbound      bool   `json:"track_outbound"`
+	TrackDownloads     bool   `json:"track_downloads"`
+	DownloadExtensions string `json:"download_extensions"`
+	TrackerHash        string `json:"tracker_hash,omitempty"` // 站点追踪脚本的内容哈希，可作为脚本地址的 v 参数长期缓存
+
 	EventCount  int64 `json:"event_count,omitempty"`  // 事件总数
 	UserCount   int64 `json:"user_count,omitempty"`   // 用户数
 	PageView    int64 `json:"page_view,omitempty"`    // 页面浏览量
@@ -21,20 +21,43 @@ func (DailyStats) TableName() string {
 	return "daily_stats"
 }
 
+// DailyRevenue 按天聚合的收入，按会话入口信息归因到来源、着陆页和国家
+type DailyRevenue struct {
+	gorm.Model           // 自动添加 ID、CreatedAt、UpdatedAt、DeletedAt 字段
+	SiteID     uint64    `gorm:"not null"`                              // 网站ID
+	Dimension  string    `gorm:"size:50;not null"`                      // 维度 (referrer, landing, country)
+	Item       string    `gorm:"size:255;not null"`                     // 维度下的具体项
+	Revenue    float64   `gorm:"type:numeric(18,4);not null;default:0"` // 收入（站点报表货币）
+	Orders     int64     `gorm:"not null;default:0"`                    // 订单数
+	Date       time.Time `gorm:"type:date;not null"`                    // 统计日期 (按天)
+}
+
+// 表名
+func (DailyRevenue) TableName() string {
+	return "daily_revenue"
+}
+
 // SimpleSiteStats 详细网站统计信息
 type SimpleSiteStats struct {
-	SiteID      uint64  `json:"site_id"`
-	PV          int64   `json:"pv"`           // 页面浏览量
-	UV          int64   `json:"uv"`           // 独立访客数
-	IPCount     int64   `json:"ip_count"`     // 独立IP数
-	EventCount  int64   `json:"event_count"`  // 事件数
-	BounceRate  float64 `json:"bounce_rate"`  // 跳出率
-	AvgDuration float64 `json:"avg_duration"` // 平均访问时长（秒）
-	WeekUv      int64   `json:"week_uv"`      // 本周UV
-	WeekPv      int64   `json:"week_pv"`      // 本周PV
-	MonthUv     int64   `json:"month_uv"`     // 本月UV
-	MonthPv     int64   `json:"month_pv"`     // 本月PV
-	HourlyStats []struct {
+	SiteID         uint64  `json:"site_id"`
+	PV             int64   `json:"pv"`               // 页面浏览量
+	UV             int64   `json:"uv"`               // 独立访客数
+	IPCount        int64   `json:"ip_count"`         // 独立IP数
+	EventCount     int64   `json:"event_count"`      // 事件数
+	BounceRate     float64 `json:"bounce_rate"`      // 跳出率
+	AvgDuration    float64 `json:"avg_duration"`     // 平均访问时长（秒）
+	AvgEngagedTime float64 `json:"avg_engaged_time"` // 每次访问的平均前台停留时长（秒）
+	AvgScrollDepth float64 `json:"avg_scroll_depth"` // 页面浏览的平均滚动深度（%）
+	WeekUv         int64   `json:"week_uv"`          // 本周UV
+	WeekPv         int64   `json:"week_pv"`          // 本周PV
+	MonthUv        int64   `json:"month_uv"`         // 本月UV
+	MonthPv        int64   `json:"month_pv"`         // 本月PV
+
+	Revenue        float64 `json:"revenue"`         // 收入（站点报表货币）
+	Orders         int64   `json:"orders"`          // 订单数
+	ConversionRate float64 `json:"conversion_rate"` // 转化率：有购买的会话占比（%）
+	Currency       string  `json:"currency"`        // 报表货币
+	HourlyStats    []struct {
 		Hour  int   `json:"hour"`
 		Count int64 `json:"count"`
 	} `json:"hourly_stats"` // 按小时流量分布
@@ -46,3 +69,37 @@ type RankStats struct {
 	Key   string `json:"key"`
 	Count int64  `json:"count"`
 }
+
+// PageMetrics 页面指标，停留时长和滚动深度只统计上报了互动数据的页面浏览
+type PageMetrics struct {
+	URL            string  `json:"url"`
+	PageViews      int64   `json:"page_views"`       // 页面浏览量
+	Visitors       int64   `json:"visitors"`         // 独立会话数
+	AvgEngagedTime float64 `json:"avg_engaged_time"` // 平均前台停留时长（秒）
+	AvgScrollDepth float64 `json:"avg_scroll_depth"` // 平均滚动深度（%）
+}
+
+// PropertyStats 事件属性分布
+type PropertyStats struct {
+	Value    string `json:"value"`    // 属性值，列出属性名时为属性名
+	Count    int64  `json:"count"`    // 事件数
+	Sessions int64  `json:"sessions"` // 独立会话数
+}
+
+// RevenueStats 收入排行
+type RevenueStats struct {
+	Key     string  `json:"key"`
+	Revenue float64 `json:"revenue"`
+	Orders  int64   `json:"orders"`
+}
+
+// CampaignStats 广告活动效果
+type CampaignStats struct {
+	Key            string  `json:"key"`             // 活动名称（或按其他 UTM 字段分组的值）
+	Visitors       int64   `json:"visitors"`        // 访客数（会话数）
+	Bounces        int64   `json:"-"`               // 跳出会话数
+	BounceRate     float64 `json:"bounce_rate"`     // 跳出率（%）
+	Conversions    int64   `json:"conversions"`     // 有购买的会话数
+	ConversionRate float64 `json:"conversion_rate"` // 转化率（%）
+	Revenue        float64 `json:"revenue"`         // 收入（站点报表货币）
+}
@@ -5,6 +5,7 @@ import (
 	"pingoo/config"
 	"pingoo/controllers"
 	"pingoo/middleware"
+	"pingoo/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -13,8 +14,8 @@ import (
 // SetupRouter 设置路由
 func SetupRouter(router *gin.Engine, db *gorm.DB, cfg *config.Config) *gin.Engine {
 	// 设置中间件
-	// 日志中间件，用于记录所有HTTP请求的详细信息，包括请求方法、路径、状态码、响应时间等
-	router.Use(gin.Logger(), middleware.CustomRecovery())
+	// 日志中间件，用于记录所有HTTP请求的详细信息，包括请求方法、路径、状态码、响应时间等，客户端IP截断后输出
+	router.Use(middleware.Logger(), middleware.CustomRecovery())
 	// 设置CORS
 	router.Use(func(c *gin.Context) {
 		// 允许所有来源
@@ -38,6 +39,10 @@ func SetupRouter(router *gin.Engine, db *gorm.DB, cfg *config.Config) *gin.Engin
 	eventController := controllers.NewEventController()
 	// 创建站点控制器实例
 	siteController := controllers.NewSiteController(db)
+	// 创建系统管理控制器实例
+	adminController := controllers.NewAdminController()
+	// 创建追踪脚本控制器实例
+	trackerController := controllers.NewTrackerController()
 
 	// API路由组
 	api := router.Group("/api")
@@ -57,45 +62,72 @@ func SetupRouter(router *gin.Engine, db *gorm.DB, cfg *config.Config) *gin.Engin
 		// 事件相关路由
 		events := api.Group("/events")
 		{
-			events.POST("", middleware.AuthMiddleware(), eventController.CreateEvent)                      // 创建事件
-			events.GET("/:site_id", middleware.AuthMiddleware(), eventController.GetEvents)                // 获取网站下事件列表
-			events.GET("/:site_id/stats", middleware.AuthMiddleware(), eventController.GetEventsRank)      // 获取事件统计排行
-			events.GET("/:site_id/summary", middleware.AuthMiddleware(), eventController.GetEventsSummary) // 获取网站下整体流量指标
+			events.POST("", middleware.AuthMiddleware(), eventController.CreateEvent)                           // 创建事件
+			events.GET("/:site_id", middleware.AuthMiddleware(), eventController.GetEvents)                     // 获取网站下事件列表
+			events.GET("/:site_id/stats", middleware.AuthMiddleware(), eventController.GetEventsRank)           // 获取事件统计排行
+			events.GET("/:site_id/summary", middleware.AuthMiddleware(), eventController.GetEventsSummary)      // 获取网站下整体流量指标
+			events.GET("/:site_id/properties", middleware.AuthMiddleware(), eventController.GetEventProperties) // 获取自定义事件属性分布
+			events.GET("/:site_id/revenue", middleware.AuthMiddleware(), eventController.GetRevenue)            // 获取收入归因排行
+			events.GET("/:site_id/campaigns", middleware.AuthMiddleware(), eventController.GetCampaigns)        // 获取广告活动效果
+			events.GET("/:site_id/pages", middleware.AuthMiddleware(), eventController.GetPageMetrics)          // 获取页面停留时长和滚动深度
 		}
 
 		// 站点管理路由
 		sites := api.Group("/sites")
 		sites.Use(middleware.AuthMiddleware())
 		{
-			sites.GET("", siteController.List)                    // 获取站点列表
-			sites.POST("", siteController.Create)                 // 创建站点
-			sites.GET("/:id", siteController.Get)                 // 获取站点详情
-			sites.PUT("/:id", siteController.Update)              // 更新站点信息
-			sites.DELETE("/:id", siteController.Delete)           // 删除站点
-			sites.DELETE("/:id/stats", siteController.ClearStats) // 删除网站所有统计数据
+			sites.GET("", siteController.List)                                // 获取站点列表
+			sites.POST("", siteController.Create)                             // 创建站点
+			sites.GET("/:id", siteController.Get)                             // 获取站点详情
+			sites.PUT("/:id", siteController.Update)                          // 更新站点信息
+			sites.DELETE("/:id", siteController.Delete)                       // 删除站点
+			sites.DELETE("/:id/stats", siteController.ClearStats)             // 删除网站所有统计数据
+			sites.POST("/:id/ingest-key", siteController.RegenerateIngestKey) // 重新生成采集密钥
+			sites.GET("/:id/ingest-stats", siteController.IngestStats)        // 获取上报限流统计
+			sites.POST("/:id/ignore", siteController.IgnoreMe)                // 不统计当前浏览器的访问
+			sites.DELETE("/:id/ignore", siteController.UnignoreMe)            // 恢复统计当前浏览器的访问
+		}
+
+		// 系统管理路由，仅管理员可访问
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(), middleware.RequireRole("admin"))
+		{
+			admin.GET("/geo", adminController.GeoStatus)         // 获取IP地理位置数据库状态
+			admin.POST("/geo/reload", adminController.ReloadGeo) // 重新加载IP地理位置数据库
 		}
 	}
 
 	// 健康检查路由
 	router.GET("/health", func(c *gin.Context) {
+		data := gin.H{}
+		if queue := services.GetIngestQueue(); queue != nil {
+			data["queue_depth"] = queue.Depth()
+		}
+		if spool := services.GetSpool(); spool != nil {
+			data["spool"] = spool.Stats()
+		}
+		if limiter := services.GetIngestLimiter(); limiter != nil {
+			data["banned_clients"] = limiter.BannedClients()
+		}
+		if geoDB := services.GetGeoDatabase(); geoDB != nil {
+			data["geo"] = geoDB.HealthStatus()
+		}
 		c.JSON(200, gin.H{
 			"code": 0,
 			"msg":  "服务运行正常",
+			"data": data,
 		})
 	})
 
-	// 静态文件路由 - 追踪脚本
-	// 访问 /pingoo.js 和配置的 TRACKER_SCRIPT_NAME 时都返回 /public/js/pingoo.js
-	pingooScriptHandler := func(c *gin.Context) {
-		// 设置缓存头，缓存文件1天
-		c.Header("Cache-Control", "public, max-age=86400")
-		c.File("./public/js/pingoo.js")
-	}
-	router.GET("/pingoo.js", pingooScriptHandler)
+	// 追踪脚本，由服务端生成，/pingoo.js?site=ID 返回按站点设置生成的脚本
+	// 访问 /pingoo.js 和配置的 TRACKER_SCRIPT_NAME 时返回相同的脚本
+	router.GET("/pingoo.js", trackerController.Script)
 	if cfg.Site.TrackerScriptName != "" && cfg.Site.TrackerScriptName != "pingoo.js" {
-		router.GET("/"+cfg.Site.TrackerScriptName, pingooScriptHandler)
+		router.GET("/"+cfg.Site.TrackerScriptName, trackerController.Script)
 	}
-	router.POST("/send", eventController.TrackCustomEvent) // 统一事件追踪接口
+	router.POST("/send", eventController.TrackCustomEvent)       // 统一事件追踪接口
+	router.POST("/send/batch", eventController.TrackBatchEvents) // 批量事件追踪接口
+	router.GET("/p.gif", eventController.TrackPixel)             // 像素追踪接口
 
 	// 使用多模板渲染器
 	router.HTMLRender = controllers.LoadLocalTemplates("./templates")
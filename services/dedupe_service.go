@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"pingoo/config"
+	"pingoo/models"
+)
+
+// ErrDuplicateEvent 重复上报的事件，已被忽略
+var ErrDuplicateEvent = errors.New("重复事件，已忽略")
+
+// Deduper 上报去重
+// 客户端携带 event_id 时在 EventIDTTL 内只接收一次；
+// 页面浏览在 Window 内按 (站点, 会话, 页面) 去重，过滤重复触发、SPA 重渲染和网络重试。
+type Deduper struct {
+	window     time.Duration
+	eventIDTTL time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time // 键 -> 过期时间
+	lastSweep time.Time
+}
+
+var eventDeduper *Deduper
+
+// InitDeduper 创建全局去重器，两个时间窗口都为 0 时返回 nil
+func InitDeduper(cfg config.IngestConfig) *Deduper {
+	if cfg.DedupeWindow <= 0 && cfg.EventIDTTL <= 0 {
+		eventDeduper = nil
+		return nil
+	}
+	eventDeduper = &Deduper{
+		window:     cfg.DedupeWindow,
+		eventIDTTL: cfg.EventIDTTL,
+		seen:       make(map[string]time.Time),
+		lastSweep:  time.Now(),
+	}
+	return eventDeduper
+}
+
+// GetDeduper 获取全局去重器，未启用时为 nil
+func GetDeduper() *Deduper {
+	return eventDeduper
+}
+
+// Check 判断事件是否重复，不重复时记录下来
+func (d *Deduper) Check(eventCreate *models.EventCreate) error {
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sweepLocked(now)
+
+	if eventCreate.EventID != "" && d.eventIDTTL > 0 {
+		if d.seenLocked(eventIDKey(eventCreate), now, d.eventIDTTL) {
+			return ErrDuplicateEvent
+		}
+	}
+	// 匿名事件没有会话ID，无法按会话判断重复
+	if eventCreate.EventType == "page_view" && eventCreate.SessionID != "" && d.window > 0 {
+		if d.seenLocked(pageViewKey(eventCreate), now, d.window) {
+			// 事件ID已记录，但本次并未接收，撤销以免影响重试
+			if eventCreate.EventID != "" {
+				delete(d.seen, eventIDKey(eventCreate))
+			}
+			return ErrDuplicateEvent
+		}
+	}
+	return nil
+}
+
+// Forget 撤销事件的去重记录，事件未能接收（如队列已满）时调用，使客户端重试不被当作重复
+func (d *Deduper) Forget(eventCreate *models.EventCreate) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if eventCreate.EventID != "" {
+		delete(d.seen, eventIDKey(eventCreate))
+	}
+	if eventCreate.EventType == "page_view" && eventCreate.SessionID != "" {
+		delete(d.seen, pageViewKey(eventCreate))
+	}
+}
+
+func eventIDKey(eventCreate *models.EventCreate) string {
+	return fmt.Sprintf("id|%d|%s", eventCreate.SiteID, eventCreate.EventID)
+}
+
+func pageViewKey(eventCreate *models.EventCreate) string {
+	return fmt.Sprintf("pv|%d|%s|%s|%s", eventCreate.SiteID, eventCreate.SessionID, eventCreate.URL, eventCreate.EventType)
+}
+
+// seenLocked 键在有效期内已存在时返回 true，否则记录并返回 false，调用方需持有锁
+func (d *Deduper) seenLocked(key string, now time.Time, ttl time.Duration) bool {
+	if expires, ok := d.seen[key]; ok && now.Before(expires) {
+		return true
+	}
+	d.seen[key] = now.Add(ttl)
+	return false
+}
+
+// sweepLocked 定期清理过期的键，调用方需持有锁
+func (d *Deduper) sweepLocked(now time.Time) {
+	if now.Sub(d.lastSweep) < 10*time.Second {
+		return
+	}
+	d.lastSweep = now
+	for key, expires := range d.seen {
+		if now.After(expires) {
+			delete(d.seen, key)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"pingoo/database"
+	"pingoo/models"
+	"pingoo/utils"
+
+	"gorm.io/gorm"
+)
+
+// EngagementEventType 追踪脚本上报页面互动数据的事件类型，event_value 为对应页面浏览的 event_id。
+// 不单独写入事件表，而是更新该页面浏览和所属会话
+const EngagementEventType = "engagement"
+
+// MaxEngagedTime 单次页面浏览可记录的最长停留时长（秒）
+const MaxEngagedTime = 24 * 60 * 60
+
+// validateEngagement 校验互动事件的参数
+func validateEngagement(eventCreate *models.EventCreate) error {
+	if eventCreate.EventValue == "" || len(eventCreate.EventValue) > 64 {
+		return errors.New("无效的页面事件ID")
+	}
+	if eventCreate.EngagedTime < 0 || eventCreate.EngagedTime > MaxEngagedTime {
+		return errors.New("无效的停留时长")
+	}
+	if eventCreate.ScrollDepth < 0 || eventCreate.ScrollDepth > 100 {
+		return errors.New("无效的滚动深度")
+	}
+	return nil
+}
+
+// engagementKey 同一次页面浏览，匿名事件的会话ID为空
+type engagementKey struct {
+	SiteID    uint64
+	SessionID string
+	PageID    string
+}
+
+// mergeEngagements 合并同一页面浏览的多次上报，脚本上报的是累计值，取最大值即可，重复或乱序上报不影响结果
+func mergeEngagements(events []*models.Event) ([]engagementKey, map[engagementKey]*models.Event) {
+	var order []engagementKey
+	merged := make(map[engagementKey]*models.Event)
+	for _, event := range events {
+		key := engagementKey{SiteID: event.SiteID, SessionID: event.SessionID, PageID: event.EventValue}
+		existing, ok := merged[key]
+		if !ok {
+			copied := *event
+			merged[key] = &copied
+			order = append(order, key)
+			continue
+		}
+		if *event.EngagedTime > *existing.EngagedTime {
+			existing.EngagedTime = event.EngagedTime
+		}
+		if *event.ScrollDepth > *existing.ScrollDepth {
+			existing.ScrollDepth = event.ScrollDepth
+		}
+		if event.CreatedAt.After(existing.CreatedAt) {
+			existing.CreatedAt = event.CreatedAt
+		}
+	}
+	return order, merged
+}
+
+// applyEngagements 把互动数据写入对应的页面浏览，停留时长的增量计入会话，
+// 并按最后一次上报的时间延长会话时长，只浏览了一个页面的会话也能得到访问时长
+func applyEngagements(tx *gorm.DB, events []*models.Event) error {
+	order, merged := mergeEngagements(events)
+	for _, key := range order {
+		engagement := merged[key]
+		var page models.Event
+		// 页面事件ID由客户端生成，只在同一会话内查找，避免其他访客上报相同ID改写别人的页面浏览
+		err := tx.Select("id", "engaged_time").
+			Where("site_id = ? AND session_id = ? AND event_id = ? AND event_type = 'page_view'", key.SiteID, key.SessionID, key.PageID).
+			First(&page).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 页面浏览被排除、去重或已过期，忽略
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("查询页面浏览失败: %v", err)
+		}
+
+		engaged := *engagement.EngagedTime
+		previous := 0
+		if page.EngagedTime != nil {
+			previous = *page.EngagedTime
+		}
+		if engaged < previous {
+			engaged = previous
+		}
+		if err = tx.Model(&models.Event{}).Where("id = ?", page.ID).Updates(map[string]interface{}{
+			"engaged_time": engaged,
+			"scroll_depth": gorm.Expr("GREATEST(COALESCE(scroll_depth, 0), ?)", *engagement.ScrollDepth),
+		}).Error; err != nil {
+			return fmt.Errorf("更新页面互动数据失败: %v", err)
+		}
+
+		// 匿名页面浏览没有会话
+		if key.SessionID == "" {
+			continue
+		}
+		if err = tx.Model(&models.Session{}).
+			Where("session_id = ? AND site_id = ?", key.SessionID, key.SiteID).
+			Updates(map[string]interface{}{
+				"engaged_time": gorm.Expr("engaged_time + ?", engaged-previous),
+				"end_time":     gorm.Expr("GREATEST(end_time, ?)", engagement.CreatedAt.Add(SessionTimeout)),
+				"duration":     gorm.Expr("GREATEST(duration, CAST(EXTRACT(EPOCH FROM (CAST(? AS TIMESTAMPTZ) - start_time)) AS INTEGER))", engagement.CreatedAt),
+			}).Error; err != nil {
+			return fmt.Errorf("更新会话停留时长失败: %v", err)
+		}
+	}
+	return nil
+}
+
+// GetPageMetrics 按页面统计浏览量、访客数、平均停留时长和滚动深度
+func (s *EventService) GetPageMetrics(siteID uint64, startDate, endDate string, page, pageSize int) (*[]models.PageMetrics, int64, error) {
+	var pageMetrics []models.PageMetrics
+	db := database.GetDB()
+
+	// 解析日期
+	start, err := utils.ParseDate(startDate)
+	if err != nil {
+		return &pageMetrics, 0, fmt.Errorf("开始日期格式错误: %v", err)
+	}
+	end, err := utils.ParseDate(endDate)
+	if err != nil {
+		return &pageMetrics, 0, fmt.Errorf("结束日期格式错误: %v", err)
+	}
+	end = end.Add(24 * time.Hour)
+	startStr, endStr := start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05")
+
+	// 获取排行数据，未上报互动数据的页面浏览为 NULL，不参与平均
+	sql := `
+		SELECT url,
+			COUNT(*) AS page_views,
+			COUNT(DISTINCT NULLIF(session_id, '')) AS visitors,
+			COALESCE(AVG(engaged_time), 0) AS avg_engaged_time,
+			COALESCE(AVG(scroll_depth), 0) AS avg_scroll_depth
+		FROM events
+		WHERE site_id = ? AND is_spam = false AND event_type = 'page_view' AND created_at >= ? AND created_at < ? AND deleted_at IS NULL
+		GROUP BY url
+		ORDER BY page_views DESC
+		LIMIT ? OFFSET ?
+	`
+	if err = db.Raw(sql, siteID, startStr, endStr, pageSize, (page-1)*pageSize).Scan(&pageMetrics).Error; err != nil {
+		return &pageMetrics, 0, fmt.Errorf("统计页面指标失败: %v", err)
+	}
+
+	// 获取总量
+	var total int64
+	sqlTotal := `
+		SELECT COUNT(DISTINCT url)
+		FROM events
+		WHERE site_id = ? AND is_spam = false AND event_type = 'page_view' AND created_at >= ? AND created_at < ? AND deleted_at IS NULL
+	`
+	if err = db.Raw(sqlTotal, siteID, startStr, endStr).Scan(&total).Error; err != nil {
+		return &pageMetrics, 0, fmt.Errorf("统计页面总数失败: %v", err)
+	}
+
+	return &pageMetrics, total, nil
+}
@@ -1,12 +1,16 @@
 package services
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
+	"pingoo/config"
 	"pingoo/database"
 	"pingoo/models"
 	"pingoo/utils"
@@ -16,6 +20,32 @@ import (
 
 type EventService struct{}
 
+// ErrEventSpooled 数据库写入失败，事件已暂存到本地等待回放
+var ErrEventSpooled = errors.New("数据库暂不可用，事件已暂存")
+
+// 事件自定义属性限制
+const (
+	MaxEventProperties     = 20   // 单个事件最多属性数
+	MaxPropertyKeyLength   = 64   // 属性名最大长度
+	MaxPropertyValueSize   = 256  // 字符串属性值最大长度
+	MaxEventPropertiesSize = 2048 // 属性序列化后最大字节数
+)
+
+// 事件字段长度限制，与数据库字段长度一致，超长的事件写库失败后会反复回放
+const (
+	MaxEventTypeLength  = 32   // 事件类型最大长度
+	MaxEventValueLength = 255  // 事件值（自定义事件名）最大长度，与 DailyStats 统计项一致
+	MaxSessionIDLength  = 64   // 会话ID最大长度
+	MaxUserIDLength     = 64   // 用户ID最大长度
+	MaxSourceLength     = 100  // 规范来源名最大长度
+	MaxURLLength        = 2048 // 页面地址和来源地址最大长度
+	MaxScreenLength     = 16   // 屏幕尺寸最大长度，超长时截断
+	MaxStatsItemLength  = 255  // DailyStats 统计项和会话来源域名最大长度，超长时截断
+)
+
+// SessionTimeout 会话的结束时间为最后一次访问后的这段时间
+const SessionTimeout = 15 * time.Minute
+
 // NewEventService 创建事件服务实例
 func NewEventService() *EventService {
 	return &EventService{}
@@ -23,127 +53,507 @@ func NewEventService() *EventService {
 
 // CreateEvent 创建事件
 func (s *EventService) CreateEvent(eventCreate *models.EventCreate) (*models.Event, error) {
-	if eventCreate.SessionID == "" || eventCreate.URL == "" || eventCreate.EventType == "" {
-		return nil, errors.New("缺少必需参数")
+	if err := ValidateEventCreate(eventCreate); err != nil {
+		return nil, err
+	}
+	// 重复事件直接忽略
+	deduper := GetDeduper()
+	if deduper != nil {
+		if err := deduper.Check(eventCreate); err != nil {
+			return nil, err
+		}
 	}
-	// ip匿名化
-	anonIp, err := utils.AnonymizeIP(eventCreate.IP)
+	receivedAt := time.Now()
+	event := newEvent(eventCreate, receivedAt)
+	if !enrichEvent(event) {
+		return nil, ErrReferrerSpam
+	}
+	applyRevenue([]*models.Event{event})
+
+	db := database.GetDB()
+
+	// 使用事务处理
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// 互动数据只更新对应的页面浏览
+		if event.EventType == EngagementEventType {
+			if event.IsSpam {
+				return nil
+			}
+			return applyEngagements(tx, []*models.Event{event})
+		}
+		// 创建事件
+		if err := tx.Create(event).Error; err != nil {
+			return fmt.Errorf("创建事件失败: %v", err)
+		}
+		// 标记为垃圾来源的事件只保留记录，不计入统计和会话
+		if event.IsSpam {
+			return nil
+		}
+		// 更新DailyStats统计表
+		if err := UpsertDailyStatsBatch(tx, event.SiteID, dailyStatsUpdates(event), event.CreatedAt); err != nil {
+			return fmt.Errorf("更新DailyStats统计表失败: %v", err)
+		}
+		// 更新会话，匿名事件没有会话
+		if event.SessionID != "" {
+			if err := touchSession(tx, newSessionDelta(event)); err != nil {
+				return err
+			}
+		}
+		// 更新收入统计
+		if err := upsertDailyRevenue(tx, []*models.Event{event}); err != nil {
+			return fmt.Errorf("更新收入统计失败: %v", err)
+		}
+		return nil
+	})
+
 	if err != nil {
-		log.Println(err.Error())
+		log.Printf("写入事件失败: %v", err)
+		if spool := GetSpool(); spool != nil {
+			if spoolErr := spool.Append([]PendingEvent{{Event: *eventCreate, ReceivedAt: receivedAt}}); spoolErr == nil {
+				return event, ErrEventSpooled
+			}
+		}
+		// 写入失败，允许客户端用同一事件ID重试
+		if deduper != nil {
+			deduper.Forget(eventCreate)
+		}
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// CreateEventsBatch 批量写入事件，合并 DailyStats 增量和会话更新后在一个事务内完成
+func (s *EventService) CreateEventsBatch(pending []PendingEvent) error {
+	events := make([]*models.Event, 0, len(pending))
+	var engagements []*models.Event
+	stats := make(map[dailyStatsKey]int64)
+	sessions := make(map[sessionKey]*sessionDelta)
+	var sessionOrder []sessionKey
+
+	for i := range pending {
+		if err := ValidateEventCreate(&pending[i].Event); err != nil {
+			log.Printf("丢弃无效事件: %v", err)
+			continue
+		}
+		event := newEvent(&pending[i].Event, pending[i].ReceivedAt)
+		if !enrichEvent(event) {
+			continue
+		}
+		if event.EventType == EngagementEventType {
+			if !event.IsSpam {
+				engagements = append(engagements, event)
+			}
+			continue
+		}
+		events = append(events, event)
+		// 标记为垃圾来源的事件只保留记录，不计入统计和会话
+		if event.IsSpam {
+			continue
+		}
+
+		date := event.CreatedAt.Format("2006-01-02")
+		for _, u := range dailyStatsUpdates(event) {
+			stats[dailyStatsKey{SiteID: event.SiteID, Date: date, Category: u.Category, Item: u.Item}] += u.PVDelta
+		}
+
+		// 匿名事件没有会话
+		if event.SessionID == "" {
+			continue
+		}
+		delta := newSessionDelta(event)
+		key := sessionKey{SiteID: delta.SiteID, SessionID: delta.SessionID}
+		if existing, ok := sessions[key]; ok {
+			existing.merge(delta)
+		} else {
+			sessions[key] = delta
+			sessionOrder = append(sessionOrder, key)
+		}
+	}
+	if len(events) == 0 && len(engagements) == 0 {
+		return nil
+	}
+	applyRevenue(events)
+
+	// 固定写入顺序，避免多个写入协程之间互相死锁
+	rows := make([]models.DailyStats, 0, len(stats))
+	for key, pv := range stats {
+		date, _ := time.ParseInLocation("2006-01-02", key.Date, time.Local)
+		rows = append(rows, models.DailyStats{SiteID: key.SiteID, Category: key.Category, Item: key.Item, PV: pv, Date: date})
 	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.SiteID != b.SiteID {
+			return a.SiteID < b.SiteID
+		}
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Category != b.Category {
+			return a.Category < b.Category
+		}
+		return a.Item < b.Item
+	})
+
+	db := database.GetDB()
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(events) > 0 {
+			if err := tx.CreateInBatches(events, 500).Error; err != nil {
+				return fmt.Errorf("批量创建事件失败: %v", err)
+			}
+		}
+		if err := UpsertDailyStats(tx, rows); err != nil {
+			return fmt.Errorf("更新DailyStats统计表失败: %v", err)
+		}
+		for _, key := range sessionOrder {
+			if err := touchSession(tx, sessions[key]); err != nil {
+				return err
+			}
+		}
+		if err := upsertDailyRevenue(tx, events); err != nil {
+			return fmt.Errorf("更新收入统计失败: %v", err)
+		}
+		// 互动数据在页面浏览写入之后处理，同一批中的页面浏览也能匹配到
+		return applyEngagements(tx, engagements)
+	})
+}
 
+// ValidateEventCreate 校验事件必需参数
+func ValidateEventCreate(eventCreate *models.EventCreate) error {
+	if eventCreate.URL == "" || eventCreate.EventType == "" {
+		return errors.New("缺少必需参数")
+	}
+	// 匿名事件不关联会话，其余事件必须携带会话ID
+	if eventCreate.SessionID == "" && !eventCreate.Anonymous {
+		return errors.New("缺少必需参数")
+	}
+	if len(eventCreate.EventID) > 64 {
+		return errors.New("事件ID过长")
+	}
+	if len(eventCreate.EventType) > MaxEventTypeLength {
+		return errors.New("事件类型过长")
+	}
+	if len(eventCreate.EventValue) > MaxEventValueLength {
+		return errors.New("事件名称过长")
+	}
+	if len(eventCreate.SessionID) > MaxSessionIDLength {
+		return errors.New("会话ID过长")
+	}
+	if len(eventCreate.UserID) > MaxUserIDLength {
+		return errors.New("用户ID过长")
+	}
+	if len(eventCreate.URL) > MaxURLLength {
+		return errors.New("页面地址过长")
+	}
+	if len(eventCreate.Referrer) > MaxURLLength {
+		return errors.New("来源地址过长")
+	}
+	if eventCreate.EventType == EngagementEventType {
+		if err := validateEngagement(eventCreate); err != nil {
+			return err
+		}
+	}
+	if (eventCreate.EventType == "outbound" || eventCreate.EventType == "download") && eventCreate.EventValue == "" {
+		return errors.New("缺少目标链接")
+	}
+	if eventCreate.EventType == "purchase" {
+		if eventCreate.Amount <= 0 || eventCreate.Amount >= 1e12 {
+			return errors.New("购买事件的金额无效")
+		}
+		if eventCreate.Currency != "" && !IsSupportedCurrency(eventCreate.Currency) {
+			return fmt.Errorf("不支持的货币: %s", eventCreate.Currency)
+		}
+	}
+	return validateProperties(eventCreate.Properties)
+}
+
+// validateProperties 校验自定义属性的数量、长度和值类型
+func validateProperties(properties models.EventProperties) error {
+	if len(properties) == 0 {
+		return nil
+	}
+	if len(properties) > MaxEventProperties {
+		return fmt.Errorf("事件属性不能超过%d个", MaxEventProperties)
+	}
+	for key, value := range properties {
+		if key == "" || len(key) > MaxPropertyKeyLength {
+			return fmt.Errorf("属性名长度需在1到%d之间", MaxPropertyKeyLength)
+		}
+		switch v := value.(type) {
+		case string:
+			if len(v) > MaxPropertyValueSize {
+				return fmt.Errorf("属性 %s 的值过长", key)
+			}
+		case float64, bool, nil:
+		default:
+			return fmt.Errorf("属性 %s 的值只能是字符串、数字或布尔值", key)
+		}
+	}
+	if b, err := json.Marshal(properties); err != nil || len(b) > MaxEventPropertiesSize {
+		return errors.New("事件属性过大")
+	}
+	return nil
+}
+
+// newEvent 根据请求构造事件模型，createdAt 为事件实际发生时间
+func newEvent(eventCreate *models.EventCreate, createdAt time.Time) *models.Event {
 	event := &models.Event{
 		SessionID:   eventCreate.SessionID,
 		SiteID:      eventCreate.SiteID,
 		UserID:      eventCreate.UserID,
-		IP:          anonIp,
+		IP:          eventCreate.IP,
 		URL:         eventCreate.URL,
 		Referrer:    eventCreate.Referrer,
 		UserAgent:   eventCreate.UserAgent,
 		Device:      eventCreate.Device,
 		Browser:     eventCreate.Browser,
 		OS:          eventCreate.OS,
-		Screen:      eventCreate.Screen,
+		Screen:      utils.TruncateRunes(eventCreate.Screen, MaxScreenLength),
 		IsBot:       eventCreate.IsBot,
 		Country:     eventCreate.Country,
 		City:        eventCreate.City,
 		ISP:         eventCreate.Isp,
 		Subdivision: eventCreate.Subdivision,
+		CountryCode: eventCreate.CountryCode,
+		RegionCode:  eventCreate.RegionCode,
+		ASN:         eventCreate.ASN,
 		EventType:   eventCreate.EventType,
 		EventValue:  eventCreate.EventValue,
+		EventID:     eventCreate.EventID,
+		Properties:  eventCreate.Properties,
+		Amount:      eventCreate.Amount,
+		Currency:    strings.ToUpper(eventCreate.Currency),
+	}
+	// 提取 UTM 参数和点击ID，未单独上报查询字符串时从页面地址中解析
+	query := eventCreate.Query
+	if query == "" {
+		if i := strings.Index(eventCreate.URL, "?"); i >= 0 {
+			query = eventCreate.URL[i+1:]
+		}
 	}
+	if query != "" {
+		campaign := utils.ParseCampaign(query)
+		event.UTMSource = campaign.Source
+		event.UTMMedium = campaign.Medium
+		event.UTMCampaign = campaign.Campaign
+		event.UTMTerm = campaign.Term
+		event.UTMContent = campaign.Content
+		event.ClickIDType = campaign.ClickIDType
+		event.ClickID = campaign.ClickID
+	}
+	if eventCreate.EventType == EngagementEventType {
+		engaged, scroll := eventCreate.EngagedTime, eventCreate.ScrollDepth
+		event.EngagedTime, event.ScrollDepth = &engaged, &scroll
+	}
+	event.CreatedAt = createdAt
+	return event
+}
 
-	db := database.GetDB()
-
-	// 使用事务处理
-	err = db.Transaction(func(tx *gorm.DB) error {
-		// 创建事件
-		if err = tx.Create(event).Error; err != nil {
-			return fmt.Errorf("创建事件失败: %v", err)
-		}
-		// 更新DailyStats统计表
-		updates := []struct {
-			Category string
-			Item     string
-			PVDelta  int64
-		}{
-			{Category: "url", Item: event.URL, PVDelta: 1},
-			{"referrer", utils.NormalizeReferrer(event.Referrer), 1},
-			{Category: "os", Item: event.OS, PVDelta: 1},
-			{Category: "device", Item: event.Device, PVDelta: 1},
-			{"country", event.Country + event.Subdivision, 1},
-			{"isp", event.ISP, 1},
-			{"screen", event.Screen, 1},
-		}
-		if event.IsBot {
-			updates = append(updates, struct {
-				Category string
-				Item     string
-				PVDelta  int64
-			}{Category: "bot", Item: event.Browser, PVDelta: 1})
-		} else {
-			updates = append(updates, struct {
-				Category string
-				Item     string
-				PVDelta  int64
-			}{Category: "browser", Item: event.Browser, PVDelta: 1})
-		}
-		if event.EventValue != "" {
-			updates = append(updates, struct {
-				Category string
-				Item     string
-				PVDelta  int64
-			}{Category: "event_type", Item: event.EventValue, PVDelta: 1})
+// enrichEvent 按站点设置处理 IP，检查垃圾来源并补充流量渠道，返回 false 表示事件应被丢弃
+func enrichEvent(event *models.Event) bool {
+	site, _ := NewSiteService().GetSiteCached(event.SiteID)
+	// 上报时已处理过，这里再处理一次，确保原始 IP 不会写入数据库
+	event.IP = ProtectIP(site, event.IP)
+	if IsReferrerSpam(site, event.Referrer) {
+		if config.GetConfig().Traffic.SpamAction != "flag" {
+			return false
 		}
+		event.IsSpam = true
+		return true
+	}
+	classifyChannel(site, event)
+	return true
+}
 
-		if err = UpsertDailyStatsBatch(tx, event.SiteID, updates, time.Now()); err != nil {
-			return fmt.Errorf("更新DailyStats统计表失败: %v", err)
-		}
+// classifyChannel 判断事件的流量渠道和规范来源名，站内跳转不记录渠道
+func classifyChannel(site *models.Site, event *models.Event) {
+	host := utils.ExtractHost(event.Referrer)
+	if host != "" && site != nil && utils.MatchHost(host, allowedHosts(site)) {
+		return
+	}
+	event.Channel, event.Source = utils.ClassifyChannel(host, utils.CampaignParams{
+		Source:      event.UTMSource,
+		Medium:      event.UTMMedium,
+		ClickIDType: event.ClickIDType,
+	})
+	// 来源名可能是原样保留的 utm_source 或完整的来源域名，超长会导致整批事件写入失败
+	event.Source = utils.TruncateRunes(event.Source, MaxSourceLength)
+}
 
-		// 查找现有会话
-		var session models.Session
-		err = tx.Where("session_id = ? AND site_id = ?", event.SessionID, event.SiteID).First(&session).Error
-
-		now := time.Now()
-		AfterMinutes := now.Add(15 * time.Minute)
-
-		if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
-			// 会话不存在，创建新会话
-			newSession := models.Session{
-				SessionID: event.SessionID,
-				SiteID:    event.SiteID,
-				UserID:    event.UserID,
-				IP:        event.IP,
-				StartTime: now,
-				EndTime:   AfterMinutes,
-				Pages:     1,
-				Duration:  0,
-			}
-			if err = tx.Create(&newSession).Error; err != nil {
-				return fmt.Errorf("创建会话失败: %v", err)
-			}
-		} else if err == nil {
-			// 会话存在，更新现有会话
-			updates := map[string]interface{}{
-				"pages":    session.Pages + 1,
-				"end_time": AfterMinutes,
-				"duration": int(now.Sub(session.StartTime).Seconds()),
-			}
-			if err = tx.Model(&session).Updates(updates).Error; err != nil {
-				return fmt.Errorf("更新会话失败: %v", err)
-			}
-		} else if err != nil {
-			return fmt.Errorf("查询会话失败: %v", err)
+// dailyStatsUpdates 计算单个事件对 DailyStats 各维度的增量
+func dailyStatsUpdates(event *models.Event) []DailyStatsUpdate {
+	updates := []DailyStatsUpdate{
+		{Category: "url", Item: event.URL, PVDelta: 1},
+		{"referrer", utils.NormalizeReferrer(event.Referrer), 1},
+		{Category: "os", Item: event.OS, PVDelta: 1},
+		{Category: "device", Item: event.Device, PVDelta: 1},
+		{"country", event.Country + event.Subdivision, 1},
+		{"isp", event.ISP, 1},
+		{"screen", event.Screen, 1},
+	}
+	if event.IsBot {
+		updates = append(updates, DailyStatsUpdate{Category: "bot", Item: event.Browser, PVDelta: 1})
+	} else {
+		updates = append(updates, DailyStatsUpdate{Category: "browser", Item: event.Browser, PVDelta: 1})
+	}
+	// 渠道只统计页面浏览，避免同一次访问的自定义事件重复计数
+	if event.EventType == "page_view" && event.Channel != "" {
+		updates = append(updates,
+			DailyStatsUpdate{Category: "channel", Item: event.Channel, PVDelta: 1},
+			DailyStatsUpdate{Category: "source", Item: event.Source, PVDelta: 1},
+		)
+	}
+	// 广告活动参数
+	for _, u := range []DailyStatsUpdate{
+		{"utm_source", event.UTMSource, 1},
+		{"utm_medium", event.UTMMedium, 1},
+		{"utm_campaign", event.UTMCampaign, 1},
+		{"utm_term", event.UTMTerm, 1},
+		{"utm_content", event.UTMContent, 1},
+	} {
+		if u.Item != "" {
+			updates = append(updates, u)
 		}
+	}
+	switch {
+	// 外链和下载的事件值为目标地址，单独排行
+	case event.EventType == "outbound" || event.EventType == "download":
+		updates = append(updates, DailyStatsUpdate{Category: event.EventType, Item: event.EventValue, PVDelta: 1})
+	// 购买事件的事件值通常是订单号，不计入事件排行
+	case event.EventValue != "" && event.EventType != "purchase":
+		updates = append(updates, DailyStatsUpdate{Category: "event_type", Item: event.EventValue, PVDelta: 1})
+	}
+	// 页面地址等统计项可能超过字段长度，截断后统计，避免整批事件写入失败
+	for i := range updates {
+		updates[i].Item = utils.TruncateRunes(updates[i].Item, MaxStatsItemLength)
+	}
+	return updates
+}
 
-		return nil
-	})
+// dailyStatsKey DailyStats 唯一键，用于批量写入前合并增量
+type dailyStatsKey struct {
+	SiteID   uint64
+	Date     string
+	Category string
+	Item     string
+}
 
-	if err != nil {
-		return nil, err
+// sessionKey 会话唯一键
+type sessionKey struct {
+	SiteID    uint64
+	SessionID string
+}
+
+// sessionDelta 一批事件对同一会话的合并更新
+type sessionDelta struct {
+	SiteID    uint64
+	SessionID string
+	UserID    string
+	IP        string
+	First     time.Time // 本批最早一次访问
+	Last      time.Time // 本批最晚一次访问
+	Pages     int       // 本批页面浏览数，只统计 page_view，单页应用的路由切换同样计入
+
+	// 本批最早一次访问的入口信息，仅在创建会话时写入
+	EntryURL string
+	Referrer string
+	Country  string
+	Campaign utils.CampaignParams
+}
+
+func newSessionDelta(event *models.Event) *sessionDelta {
+	pages := 0
+	// 自定义事件、购买等不算浏览了新页面，不影响页面数和跳出率
+	if event.EventType == "page_view" {
+		pages = 1
+	}
+	return &sessionDelta{
+		SiteID:    event.SiteID,
+		SessionID: event.SessionID,
+		UserID:    event.UserID,
+		IP:        event.IP,
+		First:     event.CreatedAt,
+		Last:      event.CreatedAt,
+		Pages:     pages,
+		EntryURL:  event.URL,
+		Referrer:  utils.TruncateRunes(utils.NormalizeReferrer(event.Referrer), MaxStatsItemLength),
+		Country:   event.Country,
+		Campaign: utils.CampaignParams{
+			Source:   event.UTMSource,
+			Medium:   event.UTMMedium,
+			Campaign: event.UTMCampaign,
+			Term:     event.UTMTerm,
+			Content:  event.UTMContent,
+		},
 	}
+}
 
-	return event, nil
+// merge 合并同一会话的另一次访问
+func (d *sessionDelta) merge(other *sessionDelta) {
+	if other.First.Before(d.First) {
+		d.First = other.First
+		d.EntryURL, d.Referrer, d.Country, d.Campaign = other.EntryURL, other.Referrer, other.Country, other.Campaign
+	}
+	if other.Last.After(d.Last) {
+		d.Last = other.Last
+	}
+	if d.UserID == "" {
+		d.UserID = other.UserID
+	}
+	d.Pages += other.Pages
+}
+
+// touchSession 创建或更新会话
+func touchSession(tx *gorm.DB, delta *sessionDelta) error {
+	// 查找现有会话
+	var session models.Session
+	err := tx.Where("session_id = ? AND site_id = ?", delta.SessionID, delta.SiteID).First(&session).Error
+
+	AfterMinutes := delta.Last.Add(SessionTimeout)
+
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		// 会话不存在，创建新会话
+		newSession := models.Session{
+			SessionID: delta.SessionID,
+			SiteID:    delta.SiteID,
+			UserID:    delta.UserID,
+			IP:        delta.IP,
+			StartTime: delta.First,
+			EndTime:   AfterMinutes,
+			Pages:     delta.Pages,
+			Duration:  int(delta.Last.Sub(delta.First).Seconds()),
+			EntryURL:  delta.EntryURL,
+			Referrer:  delta.Referrer,
+			Country:   delta.Country,
+
+			UTMSource:   delta.Campaign.Source,
+			UTMMedium:   delta.Campaign.Medium,
+			UTMCampaign: delta.Campaign.Campaign,
+			UTMTerm:     delta.Campaign.Term,
+			UTMContent:  delta.Campaign.Content,
+		}
+		if err = tx.Create(&newSession).Error; err != nil {
+			return fmt.Errorf("创建会话失败: %v", err)
+		}
+	} else if err == nil {
+		// 会话存在，更新现有会话（回放的暂存事件可能早于已记录的访问，时间只向后推进）
+		updates := map[string]interface{}{
+			"pages":    gorm.Expr("pages + ?", delta.Pages),
+			"end_time": gorm.Expr("GREATEST(end_time, ?)", AfterMinutes),
+			"duration": gorm.Expr("GREATEST(duration, ?)", int(delta.Last.Sub(session.StartTime).Seconds())),
+		}
+		// 访客在会话中途登录（pingoo.identify）时，把用户ID补记到会话上
+		if session.UserID == "" && delta.UserID != "" {
+			updates["user_id"] = delta.UserID
+		}
+		if err = tx.Model(&session).Updates(updates).Error; err != nil {
+			return fmt.Errorf("更新会话失败: %v", err)
+		}
+	} else {
+		return fmt.Errorf("查询会话失败: %v", err)
+	}
+
+	return nil
 }
 
 // GetEvents 根据站点ID获取事件列表
@@ -241,21 +651,22 @@ func (s *EventService) GetEventsSummary(siteID uint64, startDate string, endDate
 	stats.StartDate = startDate
 	stats.EndDate = endDate
 
-	// 同时查询PV（页面浏览量）、UV（独立访客数）和IPCount
+	// 同时查询PV（页面浏览量）、UV（独立访客数）、IPCount和平均滚动深度
 	if err = db.Raw(`
 		SELECT
 			COUNT(*) as pv,
-			COUNT(DISTINCT(session_id)) as uv,
-			COUNT(DISTINCT(ip)) as ip_count
+			COUNT(DISTINCT NULLIF(session_id, '')) as uv,
+			COUNT(DISTINCT(ip)) as ip_count,
+			COALESCE(AVG(scroll_depth), 0) as avg_scroll_depth
 		FROM events
-		WHERE site_id = ? AND event_type = 'page_view' AND created_at BETWEEN ? AND ?
-	`, siteID, start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05")).Row().Scan(&stats.PV, &stats.UV, &stats.IPCount); err != nil {
+		WHERE site_id = ? AND is_spam = false AND event_type = 'page_view' AND created_at BETWEEN ? AND ?
+	`, siteID, start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05")).Row().Scan(&stats.PV, &stats.UV, &stats.IPCount, &stats.AvgScrollDepth); err != nil {
 		return nil, fmt.Errorf("统计PV、UV和IP失败: %v", err.Error())
 	}
 
 	// 获取自定义事件数量
 	if err = db.Model(&models.Event{}).
-		Where("site_id = ? AND event_type = 'custom' AND created_at BETWEEN ? AND ?", siteID, start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05")).
+		Where("site_id = ? AND is_spam = false AND event_type = 'custom' AND created_at BETWEEN ? AND ?", siteID, start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05")).
 		Count(&stats.EventCount).Error; err != nil {
 		return nil, fmt.Errorf("统计事件数量失败: %v", err.Error())
 	}
@@ -264,11 +675,12 @@ func (s *EventService) GetEventsSummary(siteID uint64, startDate string, endDate
 	var totalSessions int64
 	var bounceSessions int64
 	var totalDuration int64
+	var totalEngaged int64
 
 	if err = db.Model(&models.Session{}).
-		Select("COUNT(*) as session_count, COALESCE(SUM(duration), 0) as total_duration").
+		Select("COUNT(*) as session_count, COALESCE(SUM(duration), 0) as total_duration, COALESCE(SUM(engaged_time), 0) as total_engaged").
 		Where("site_id = ? AND start_time BETWEEN ? AND ?", siteID, start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05")).Row().
-		Scan(&totalSessions, &totalDuration); err != nil {
+		Scan(&totalSessions, &totalDuration, &totalEngaged); err != nil {
 		return nil, fmt.Errorf("统计会话数和访问时长失败: %v", err.Error())
 	}
 
@@ -286,13 +698,28 @@ func (s *EventService) GetEventsSummary(siteID uint64, startDate string, endDate
 		stats.BounceRate = 0
 	}
 
-	// 计算平均访问时长
+	// 计算平均访问时长和平均停留时长
 	if totalSessions > 0 {
 		stats.AvgDuration = float64(totalDuration) / float64(totalSessions)
+		stats.AvgEngagedTime = float64(totalEngaged) / float64(totalSessions)
 	} else {
 		stats.AvgDuration = 0
 	}
 
+	// 收入、订单数和转化率
+	var convertedSessions int64
+	if err = db.Model(&models.Event{}).
+		Select("COALESCE(SUM(revenue), 0), COUNT(*), COUNT(DISTINCT NULLIF(session_id, ''))").
+		Where("site_id = ? AND is_spam = false AND event_type = 'purchase' AND created_at BETWEEN ? AND ?", siteID, start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05")).Row().
+		Scan(&stats.Revenue, &stats.Orders, &convertedSessions); err != nil {
+		return nil, fmt.Errorf("统计收入失败: %v", err.Error())
+	}
+	if totalSessions > 0 {
+		stats.ConversionRate = float64(convertedSessions) / float64(totalSessions) * 100
+	}
+	site, _ := NewSiteService().GetSiteCached(siteID)
+	stats.Currency = SiteCurrency(site)
+
 	// 本周UV和PV总量（基于传入的日期所在周）
 	weekStart := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
 	for weekStart.Weekday() != time.Monday {
@@ -300,8 +727,8 @@ func (s *EventService) GetEventsSummary(siteID uint64, startDate string, endDate
 	}
 	weekEnd := weekStart.AddDate(0, 0, 7)
 	if err = db.Model(&models.Event{}).
-		Select("COUNT(*) as pv, COUNT(DISTINCT(session_id)) as uv").
-		Where("site_id = ? AND event_type = 'page_view' AND created_at >= ? AND created_at < ?", siteID, weekStart.Format("2006-01-02 15:04:05"), weekEnd.Format("2006-01-02 15:04:05")).Row().
+		Select("COUNT(*) as pv, COUNT(DISTINCT NULLIF(session_id, '')) as uv").
+		Where("site_id = ? AND is_spam = false AND event_type = 'page_view' AND created_at >= ? AND created_at < ?", siteID, weekStart.Format("2006-01-02 15:04:05"), weekEnd.Format("2006-01-02 15:04:05")).Row().
 		Scan(&stats.WeekPv, &stats.WeekUv); err != nil {
 		return nil, fmt.Errorf("统计本周数据失败: %v", err.Error())
 	}
@@ -310,8 +737,8 @@ func (s *EventService) GetEventsSummary(siteID uint64, startDate string, endDate
 	monthStart := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
 	monthEnd := monthStart.AddDate(0, 1, 0)
 	if err = db.Model(&models.Event{}).
-		Select("COUNT(*) as month_pv, COUNT(DISTINCT session_id) as uv").
-		Where("site_id = ? AND event_type = 'page_view' AND created_at >= ? AND created_at < ?", siteID, monthStart.Format("2006-01-02 15:04:05"), monthEnd.Format("2006-01-02 15:04:05")).
+		Select("COUNT(*) as month_pv, COUNT(DISTINCT NULLIF(session_id, '')) as uv").
+		Where("site_id = ? AND is_spam = false AND event_type = 'page_view' AND created_at >= ? AND created_at < ?", siteID, monthStart.Format("2006-01-02 15:04:05"), monthEnd.Format("2006-01-02 15:04:05")).
 		Row().Scan(&stats.MonthPv, &stats.MonthUv); err != nil {
 		return nil, fmt.Errorf("统计本月PV和IP失败: %v", err.Error())
 	}
@@ -320,7 +747,7 @@ func (s *EventService) GetEventsSummary(siteID uint64, startDate string, endDate
 	if err := db.Raw(`
 		SELECT EXTRACT(HOUR FROM created_at) as hour, COUNT(*) as count
 		FROM events
-		WHERE site_id = ? AND event_type = 'page_view' AND created_at >= ? AND created_at < ?
+		WHERE site_id = ? AND is_spam = false AND event_type = 'page_view' AND created_at >= ? AND created_at < ?
 		GROUP BY EXTRACT(HOUR FROM created_at)
 		ORDER BY hour
 	`, siteID, start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05")).Scan(&stats.HourlyStats).Error; err != nil {
@@ -360,7 +787,7 @@ func (s *EventService) GetEventsRank(siteID uint64, startDate, endDate, statType
 	sql := fmt.Sprintf(`
 		SELECT %s AS key, COUNT(*) as count
 		FROM events
-		WHERE site_id = ? AND event_type = ? AND created_at >= ? AND created_at < ? %s
+		WHERE site_id = ? AND is_spam = false AND event_type = ? AND created_at >= ? AND created_at < ? %s
 		GROUP BY key
 		ORDER BY count DESC
 		LIMIT ? OFFSET ?
@@ -372,7 +799,7 @@ func (s *EventService) GetEventsRank(siteID uint64, startDate, endDate, statType
 	sqlTotal := fmt.Sprintf(`
 		SELECT COUNT(distinct %s)
 		FROM events
-		WHERE site_id = ? AND event_type = ? AND created_at >= ? AND created_at < ? %s
+		WHERE site_id = ? AND is_spam = false AND event_type = ? AND created_at >= ? AND created_at < ? %s
 	`, statType, filters)
 	db.Raw(sqlTotal, siteID, eventType, start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05")).Scan(&total)
 
@@ -411,3 +838,69 @@ func (s *EventService) GetEventsRankByStats(siteID uint64, startDate, endDate, s
 
 	return &rankStats, total, nil
 }
+
+// GetEventProperties 自定义事件属性分布
+// key 为空时列出该事件出现过的属性名，否则按属性值统计事件数和独立会话数
+func (s *EventService) GetEventProperties(siteID uint64, startDate, endDate, eventValue, key string, page, pageSize int) (*[]models.PropertyStats, int64, error) {
+	var propertyStats []models.PropertyStats
+	db := database.GetDB()
+
+	// 解析日期
+	start, err := utils.ParseDate(startDate)
+	if err != nil {
+		return &propertyStats, 0, fmt.Errorf("开始日期格式错误: %v", err)
+	}
+	end, err := utils.ParseDate(endDate)
+	if err != nil {
+		return &propertyStats, 0, fmt.Errorf("结束日期格式错误: %v", err)
+	}
+	end = end.Add(24 * time.Hour)
+
+	filters := "site_id = ? AND is_spam = false AND event_type = 'custom' AND event_value = ? AND created_at >= ? AND created_at < ? AND properties IS NOT NULL"
+	args := []interface{}{siteID, eventValue, start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05")}
+
+	var sql, sqlTotal string
+	if key == "" {
+		sql = fmt.Sprintf(`
+			SELECT k.key AS value, COUNT(*) AS count, COUNT(DISTINCT NULLIF(session_id, '')) AS sessions
+			FROM events, jsonb_object_keys(properties) AS k(key)
+			WHERE %s
+			GROUP BY k.key
+			ORDER BY count DESC
+			LIMIT ? OFFSET ?
+		`, filters)
+		sqlTotal = fmt.Sprintf(`
+			SELECT COUNT(DISTINCT k.key)
+			FROM events, jsonb_object_keys(properties) AS k(key)
+			WHERE %s
+		`, filters)
+	} else {
+		filters += " AND properties->>? IS NOT NULL"
+		args = append(args, key)
+		sql = fmt.Sprintf(`
+			SELECT properties->>? AS value, COUNT(*) AS count, COUNT(DISTINCT NULLIF(session_id, '')) AS sessions
+			FROM events
+			WHERE %s
+			GROUP BY value
+			ORDER BY count DESC
+			LIMIT ? OFFSET ?
+		`, filters)
+		sqlTotal = fmt.Sprintf(`
+			SELECT COUNT(DISTINCT properties->>?)
+			FROM events
+			WHERE %s
+		`, filters)
+		args = append([]interface{}{key}, args...)
+	}
+
+	if err = db.Raw(sql, append(args, pageSize, (page-1)*pageSize)...).Scan(&propertyStats).Error; err != nil {
+		return &propertyStats, 0, fmt.Errorf("统计事件属性失败: %v", err)
+	}
+
+	var total int64
+	if err = db.Raw(sqlTotal, args...).Scan(&total).Error; err != nil {
+		return &propertyStats, 0, fmt.Errorf("统计事件属性总数失败: %v", err)
+	}
+
+	return &propertyStats, total, nil
+}
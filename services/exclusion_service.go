@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"pingoo/models"
+	"pingoo/utils"
+)
+
+// IgnoreCookieName “不统计我的访问”Cookie 名，值为用 - 分隔的站点ID
+const IgnoreCookieName = "pingoo_ignore"
+
+// ErrTrafficExcluded 访问命中站点的排除规则，事件已丢弃
+var ErrTrafficExcluded = errors.New("访问已被站点排除规则过滤")
+
+// IsExcludedTraffic 访问是否命中站点的排除规则：IP 段、“不统计我的访问”Cookie 或页面路径
+// ip 为客户端原始IP，需在 ProtectIP 之前调用
+func IsExcludedTraffic(site *models.Site, ip, urlPath, ignoreCookie string) bool {
+	if site == nil {
+		return false
+	}
+	if ignoreCookie != "" && containsSiteID(ignoreCookie, uint64(site.ID)) {
+		return true
+	}
+	if site.ExcludedIPs != "" && utils.MatchIPList(ip, utils.SplitList(site.ExcludedIPs)) {
+		return true
+	}
+	if site.ExcludedPaths != "" {
+		for _, pattern := range utils.SplitList(site.ExcludedPaths) {
+			if utils.MatchPathPattern(pattern, urlPath) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AddIgnoredSite 在 Cookie 值中加入站点ID
+func AddIgnoredSite(cookie string, siteID uint64) string {
+	if containsSiteID(cookie, siteID) {
+		return cookie
+	}
+	if cookie == "" {
+		return strconv.FormatUint(siteID, 10)
+	}
+	return cookie + "-" + strconv.FormatUint(siteID, 10)
+}
+
+// RemoveIgnoredSite 从 Cookie 值中移除站点ID
+func RemoveIgnoredSite(cookie string, siteID uint64) string {
+	id := strconv.FormatUint(siteID, 10)
+	var kept []string
+	for _, item := range strings.Split(cookie, "-") {
+		if item != "" && item != id {
+			kept = append(kept, item)
+		}
+	}
+	return strings.Join(kept, "-")
+}
+
+func containsSiteID(cookie string, siteID uint64) bool {
+	id := strconv.FormatUint(siteID, 10)
+	for _, item := range strings.Split(cookie, "-") {
+		if item == id {
+			return true
+		}
+	}
+	return false
+}
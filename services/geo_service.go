@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"pingoo/config"
+	"pingoo/utils"
+)
+
+// geoValidationIP 校验新数据库时查询的 IP，查询失败说明文件不可用
+const geoValidationIP = "8.8.8.8"
+
+// GeoDatabase 全局 IP 地理位置数据库，文件修改后自动重新加载，加载成功后才替换正在使用的数据源
+type GeoDatabase struct {
+	cfg config.GeoConfig
+
+	reloadMu sync.Mutex // 避免定时检查和管理接口同时加载
+
+	mu        sync.RWMutex
+	stamp     string // 上次加载时数据库文件的修改时间和大小
+	metadata  *utils.GeoMetadata
+	loadedAt  time.Time
+	lastError string
+}
+
+// GeoStatus 地理位置数据库的加载状态
+type GeoStatus struct {
+	Loaded bool `json:"loaded"`
+	*utils.GeoMetadata
+	LoadedAt  *time.Time `json:"loaded_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"` // 最近一次加载失败的原因
+}
+
+var geoDatabase *GeoDatabase
+
+// NewGeoProvider 按配置创建地理位置数据源
+func NewGeoProvider(cfg config.GeoConfig) (utils.GeoProvider, error) {
+	language := utils.GeoLanguageZH
+	if cfg.Language == utils.GeoLanguageEN {
+		language = utils.GeoLanguageEN
+	}
+	switch cfg.Provider {
+	case "qqwry", "":
+		return utils.NewQQwryProvider(cfg.QQwryFile, language)
+	case "mmdb":
+		return utils.NewMMDBProvider(cfg.MMDBFile, cfg.ASNFile, language)
+	default:
+		return nil, fmt.Errorf("不支持的地理位置数据源: %s", cfg.Provider)
+	}
+}
+
+// InitGeoDatabase 加载全局地理位置数据库。加载失败时仍返回数据库，文件就绪后可由定时检查或管理接口重新加载
+func InitGeoDatabase(cfg config.GeoConfig) (*GeoDatabase, error) {
+	d := &GeoDatabase{cfg: cfg}
+	geoDatabase = d
+	return d, d.Reload()
+}
+
+// GetGeoDatabase 获取全局地理位置数据库，未初始化时为 nil
+func GetGeoDatabase() *GeoDatabase {
+	return geoDatabase
+}
+
+// Reload 加载并校验数据库文件，成功后替换正在使用的数据源并释放旧数据源，失败时继续使用旧数据源
+func (d *GeoDatabase) Reload() error {
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+
+	// 读取文件前记录修改时间，加载期间文件再次修改时下次检查会重新加载
+	stamp := d.fileStamp()
+	provider, err := NewGeoProvider(d.cfg)
+	if err == nil {
+		if _, lookupErr := provider.Lookup(geoValidationIP); lookupErr != nil {
+			provider.Close()
+			err = fmt.Errorf("校验地理位置数据库失败: %v", lookupErr)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stamp = stamp
+	if err != nil {
+		d.lastError = err.Error()
+		return err
+	}
+	if old := utils.SetGeoProvider(provider); old != nil {
+		old.Close()
+	}
+	metadata := provider.Metadata()
+	d.metadata = &metadata
+	d.loadedAt = time.Now()
+	d.lastError = ""
+	return nil
+}
+
+// Status 数据库的加载状态和元数据
+func (d *GeoDatabase) Status() GeoStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	status := GeoStatus{LastError: d.lastError}
+	if d.metadata != nil {
+		metadata := *d.metadata
+		loadedAt := d.loadedAt
+		status.Loaded = true
+		status.GeoMetadata = &metadata
+		status.LoadedAt = &loadedAt
+	}
+	return status
+}
+
+// HealthStatus 用于公开健康检查的加载状态，不包含文件路径和错误详情
+func (d *GeoDatabase) HealthStatus() GeoStatus {
+	status := d.Status()
+	status.LastError = ""
+	if status.GeoMetadata != nil {
+		status.File = ""
+		status.ASNFile = ""
+	}
+	return status
+}
+
+// files 当前数据源使用的数据库文件
+func (d *GeoDatabase) files() []string {
+	if d.cfg.Provider == "mmdb" {
+		if d.cfg.ASNFile != "" {
+			return []string{d.cfg.MMDBFile, d.cfg.ASNFile}
+		}
+		return []string{d.cfg.MMDBFile}
+	}
+	return []string{d.cfg.QQwryFile}
+}
+
+// fileStamp 数据库文件的修改时间和大小，文件不存在时为空
+func (d *GeoDatabase) fileStamp() string {
+	var stamp string
+	for _, path := range d.files() {
+		if info, err := os.Stat(path); err == nil {
+			stamp += fmt.Sprintf("%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return stamp
+}
+
+// changed 数据库文件是否在上次加载后被修改、创建或删除
+func (d *GeoDatabase) changed() bool {
+	stamp := d.fileStamp()
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return stamp != d.stamp
+}
+
+// StartGeoReloader 定期检查数据库文件，修改后重新加载，ctx 结束时退出
+func StartGeoReloader(ctx context.Context, d *GeoDatabase, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !d.changed() {
+					continue
+				}
+				if err := d.Reload(); err != nil {
+					log.Printf("重新加载IP地理位置数据库失败，继续使用旧数据库: %v", err)
+					continue
+				}
+				log.Printf("已重新加载IP地理位置数据库: %s", d.Status().File)
+			}
+		}
+	}()
+}
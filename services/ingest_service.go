@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"pingoo/config"
+	"pingoo/models"
+)
+
+var (
+	// ErrQueueFull 队列已满，调用方应稍后重试
+	ErrQueueFull = errors.New("事件队列已满，请稍后重试")
+	// ErrQueueClosed 服务正在关闭，不再接收事件
+	ErrQueueClosed = errors.New("事件队列已关闭")
+)
+
+// PendingEvent 待写入的事件及其接收时间
+type PendingEvent struct {
+	Event      models.EventCreate `json:"event"`
+	ReceivedAt time.Time          `json:"received_at"`
+}
+
+// IngestQueue 事件异步写入队列
+// 事件按会话ID分配到固定的写入协程，保证同一会话内的事件顺序，
+// 每个协程在攒满 BatchSize 或到达 FlushInterval 时批量写库。
+type IngestQueue struct {
+	cfg          config.IngestConfig
+	shards       []chan PendingEvent
+	wg           sync.WaitGroup
+	mu           sync.RWMutex
+	closed       bool
+	eventService *EventService
+}
+
+var ingestQueue *IngestQueue
+
+// InitIngestQueue 创建并启动全局事件队列
+func InitIngestQueue(cfg config.IngestConfig) *IngestQueue {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 200
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 2 * time.Second
+	}
+	shardSize := cfg.QueueSize / cfg.Workers
+	if shardSize <= 0 {
+		shardSize = 1
+	}
+
+	q := &IngestQueue{
+		cfg:          cfg,
+		shards:       make([]chan PendingEvent, cfg.Workers),
+		eventService: NewEventService(),
+	}
+	for i := range q.shards {
+		q.shards[i] = make(chan PendingEvent, shardSize)
+		q.wg.Add(1)
+		go q.worker(q.shards[i])
+	}
+	ingestQueue = q
+	return q
+}
+
+// GetIngestQueue 获取全局事件队列
+func GetIngestQueue() *IngestQueue {
+	return ingestQueue
+}
+
+// Enqueue 将事件放入队列，队列满时立即返回 ErrQueueFull
+func (q *IngestQueue) Enqueue(eventCreate *models.EventCreate) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	item := PendingEvent{Event: *eventCreate, ReceivedAt: time.Now()}
+	select {
+	case q.shards[q.shardFor(eventCreate)] <- item:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Depth 当前排队中的事件数
+func (q *IngestQueue) Depth() int {
+	depth := 0
+	for _, ch := range q.shards {
+		depth += len(ch)
+	}
+	return depth
+}
+
+// Close 停止接收新事件并等待队列中剩余事件写完
+func (q *IngestQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	for _, ch := range q.shards {
+		close(ch)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shardFor 按站点和会话选择写入协程
+func (q *IngestQueue) shardFor(eventCreate *models.EventCreate) int {
+	h := fnv.New32a()
+	h.Write([]byte(eventCreate.SessionID))
+	return int((h.Sum32() + uint32(eventCreate.SiteID)) % uint32(len(q.shards)))
+}
+
+func (q *IngestQueue) worker(ch <-chan PendingEvent) {
+	defer q.wg.Done()
+
+	batch := make([]PendingEvent, 0, q.cfg.BatchSize)
+	ticker := time.NewTicker(q.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case item, ok := <-ch:
+			if !ok {
+				q.flush(batch)
+				return
+			}
+			batch = append(batch, item)
+			if len(batch) >= q.cfg.BatchSize {
+				q.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				q.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+func (q *IngestQueue) flush(batch []PendingEvent) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := q.eventService.CreateEventsBatch(batch); err != nil {
+		log.Printf("批量写入事件失败(%d条): %v", len(batch), err)
+		// 写入失败时转存到本地，数据库恢复后回放
+		if spool := GetSpool(); spool != nil {
+			if spoolErr := spool.Append(batch); spoolErr != nil {
+				log.Printf("暂存事件失败，%d条事件丢失: %v", len(batch), spoolErr)
+			}
+		}
+	}
+}
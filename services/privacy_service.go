@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net"
+	"strings"
+
+	"pingoo/config"
+	"pingoo/models"
+	"pingoo/utils"
+)
+
+// 访客开启 Do-Not-Track 或 Global Privacy Control 时的处理方式
+const (
+	PrivacySignalIgnore    = "ignore"    // 忽略，照常记录
+	PrivacySignalDrop      = "drop"      // 丢弃事件
+	PrivacySignalAnonymous = "anonymous" // 匿名记录，不关联会话和用户
+)
+
+// ErrPrivacyOptOut 访客开启了 DNT/GPC，事件已按站点设置丢弃
+var ErrPrivacyOptOut = errors.New("访客已拒绝追踪，事件已丢弃")
+
+// SitePrivacySignal 站点对 DNT/GPC 的处理方式，未设置时为 ignore
+func SitePrivacySignal(site *models.Site) string {
+	if site == nil {
+		return PrivacySignalIgnore
+	}
+	switch site.PrivacySignal {
+	case PrivacySignalDrop, PrivacySignalAnonymous:
+		return site.PrivacySignal
+	}
+	return PrivacySignalIgnore
+}
+
+// ApplyPrivacySignal 按站点设置处理开启了 DNT/GPC 的访客事件
+// drop 返回 ErrPrivacyOptOut；anonymous 去掉会话ID和用户ID，事件只计入页面和维度统计
+func ApplyPrivacySignal(site *models.Site, eventCreate *models.EventCreate) error {
+	switch SitePrivacySignal(site) {
+	case PrivacySignalDrop:
+		return ErrPrivacyOptOut
+	case PrivacySignalAnonymous:
+		eventCreate.SessionID = ""
+		eventCreate.UserID = ""
+		eventCreate.Anonymous = true
+	}
+	return nil
+}
+
+// IP 存储方式
+const (
+	IPModeTruncate = "truncate" // 按前缀长度截断
+	IPModeDrop     = "drop"     // 不保存
+	IPModeHash     = "hash"     // 密钥哈希，可用于去重但无法还原
+)
+
+// SiteIPMode 站点的 IP 存储方式，未设置时为 truncate
+func SiteIPMode(site *models.Site) string {
+	if site == nil {
+		return IPModeTruncate
+	}
+	switch site.IPMode {
+	case IPModeDrop, IPModeHash:
+		return site.IPMode
+	}
+	return IPModeTruncate
+}
+
+// ProtectIP 按站点设置将原始 IP 转换为可存储的形式，地理位置查询、限流等需在此之前完成
+// 对已转换的值再次调用结果不变，无法解析的 IP 返回空字符串
+func ProtectIP(site *models.Site, ip string) string {
+	switch SiteIPMode(site) {
+	case IPModeDrop:
+		return ""
+	case IPModeHash:
+		if strings.HasPrefix(ip, "h_") {
+			return ip
+		}
+		if net.ParseIP(ip) == nil {
+			return ""
+		}
+		return utils.HashIP(ipHashKey(), ip)
+	}
+	// 前缀长度最多 /24 和 /64，保证不会保存完整 IP
+	v4Bits, v6Bits := 24, 64
+	if site != nil {
+		v4Bits, v6Bits = min(site.IPv4Prefix, 24), min(site.IPv6Prefix, 64)
+	}
+	masked, _ := utils.TruncateIP(ip, v4Bits, v6Bits)
+	return masked
+}
+
+// LookupGeo 查询地理位置，只使用截断到 /24（IPv6 为 /64）的地址，原始 IP 不参与查询。
+// 同一网段通常属于同一地区和运营商，截断后精确到城市的结果基本不变
+func LookupGeo(ip string) *utils.IPInfo {
+	masked, err := utils.TruncateIP(ip, 24, 64)
+	if err != nil {
+		return &utils.IPInfo{}
+	}
+	info, err := utils.QueryIP(masked)
+	if err != nil {
+		if !errors.Is(err, utils.ErrGeoNotLoaded) {
+			log.Println(err)
+		}
+		return &utils.IPInfo{}
+	}
+	return info
+}
+
+// ipHashKey IP 哈希密钥，未单独配置时使用 JWT 密钥
+func ipHashKey() string {
+	cfg := config.GetConfig()
+	if cfg.Privacy.IPHashKey != "" {
+		return cfg.Privacy.IPHashKey
+	}
+	return cfg.JWT.SecretKey
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"pingoo/config"
+	"pingoo/utils"
+)
+
+var (
+	// ErrRateLimited 上报过于频繁
+	ErrRateLimited = errors.New("上报过于频繁，请稍后重试")
+	// ErrClientBanned 客户端多次超限，已被临时封禁
+	ErrClientBanned = errors.New("上报过于频繁，已被临时封禁")
+)
+
+// IngestLimiter 上报接口限流器
+// 同时按 (站点, 匿名化IP) 和站点整体限流，客户端在窗口内多次超限后会被临时封禁。
+type IngestLimiter struct {
+	cfg    config.RateLimitConfig
+	client *utils.TokenBucketLimiter
+	site   *utils.TokenBucketLimiter
+
+	mu         sync.Mutex
+	violations map[string]*violationCounter // 客户端超限记录
+	bans       map[string]time.Time         // 客户端封禁到期时间
+	dropped    map[uint64]*DroppedStats     // 各站点被丢弃的上报数
+	lastSweep  time.Time
+}
+
+// DroppedStats 站点因限流被丢弃的上报数（自服务启动起累计）
+type DroppedStats struct {
+	RateLimited int64 `json:"rate_limited"` // 超出客户端限额
+	SiteLimited int64 `json:"site_limited"` // 超出站点整体限额
+	Banned      int64 `json:"banned"`       // 封禁期间的上报
+}
+
+type violationCounter struct {
+	count int
+	since time.Time
+}
+
+var ingestLimiter *IngestLimiter
+
+// InitIngestLimiter 创建全局上报限流器，未启用时返回 nil
+func InitIngestLimiter(cfg config.RateLimitConfig) *IngestLimiter {
+	if !cfg.Enabled {
+		ingestLimiter = nil
+		return nil
+	}
+	ingestLimiter = &IngestLimiter{
+		cfg:        cfg,
+		client:     utils.NewTokenBucketLimiter(cfg.ClientRate, cfg.ClientBurst),
+		site:       utils.NewTokenBucketLimiter(cfg.SiteRate, cfg.SiteBurst),
+		violations: make(map[string]*violationCounter),
+		bans:       make(map[string]time.Time),
+		dropped:    make(map[uint64]*DroppedStats),
+	}
+	return ingestLimiter
+}
+
+// GetIngestLimiter 获取全局上报限流器，未启用时为 nil
+func GetIngestLimiter() *IngestLimiter {
+	return ingestLimiter
+}
+
+// Allow 判断站点下某个客户端的上报是否放行，ip 为客户端原始IP，内部会匿名化
+func (l *IngestLimiter) Allow(siteID uint64, ip string) error {
+	anonIP, _ := utils.AnonymizeIP(ip)
+	clientKey := fmt.Sprintf("%d|%s", siteID, anonIP)
+	now := time.Now()
+
+	l.mu.Lock()
+	if until, ok := l.bans[clientKey]; ok {
+		if now.Before(until) {
+			l.droppedLocked(siteID).Banned++
+			l.mu.Unlock()
+			return ErrClientBanned
+		}
+		delete(l.bans, clientKey)
+	}
+	l.mu.Unlock()
+
+	if !l.client.Allow(clientKey) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.droppedLocked(siteID).RateLimited++
+		if l.recordViolationLocked(clientKey, now) {
+			return ErrClientBanned
+		}
+		return ErrRateLimited
+	}
+	if !l.site.Allow(fmt.Sprintf("%d", siteID)) {
+		l.mu.Lock()
+		l.droppedLocked(siteID).SiteLimited++
+		l.mu.Unlock()
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// Dropped 获取站点被丢弃的上报数
+func (l *IngestLimiter) Dropped(siteID uint64) DroppedStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if stats, ok := l.dropped[siteID]; ok {
+		return *stats
+	}
+	return DroppedStats{}
+}
+
+// BannedClients 当前处于封禁期的客户端数
+func (l *IngestLimiter) BannedClients() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	count := 0
+	for _, until := range l.bans {
+		if now.Before(until) {
+			count++
+		}
+	}
+	return count
+}
+
+// recordViolationLocked 记录一次超限，达到阈值时封禁客户端并返回 true，调用方需持有锁
+func (l *IngestLimiter) recordViolationLocked(clientKey string, now time.Time) bool {
+	if l.cfg.BanThreshold <= 0 {
+		return false
+	}
+	l.sweepLocked(now)
+
+	v, ok := l.violations[clientKey]
+	if !ok || now.Sub(v.since) > l.cfg.BanWindow {
+		v = &violationCounter{since: now}
+		l.violations[clientKey] = v
+	}
+	v.count++
+	if v.count < l.cfg.BanThreshold {
+		return false
+	}
+	delete(l.violations, clientKey)
+	l.bans[clientKey] = now.Add(l.cfg.BanDuration)
+	return true
+}
+
+// sweepLocked 清理过期的超限记录和封禁，调用方需持有锁
+func (l *IngestLimiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, v := range l.violations {
+		if now.Sub(v.since) > l.cfg.BanWindow {
+			delete(l.violations, key)
+		}
+	}
+	for key, until := range l.bans {
+		if now.After(until) {
+			delete(l.bans, key)
+		}
+	}
+}
+
+func (l *IngestLimiter) droppedLocked(siteID uint64) *DroppedStats {
+	stats, ok := l.dropped[siteID]
+	if !ok {
+		stats = &DroppedStats{}
+		l.dropped[siteID] = stats
+	}
+	return stats
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"pingoo/config"
+	"pingoo/database"
+	"pingoo/models"
+	"pingoo/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 收入归因维度
+var revenueDimensions = map[string]bool{"referrer": true, "landing": true, "country": true}
+
+// IsSupportedCurrency 货币是否在汇率表中
+func IsSupportedCurrency(currency string) bool {
+	_, ok := config.GetConfig().Revenue.Rates[strings.ToUpper(currency)]
+	return ok
+}
+
+// SiteCurrency 站点的收入报表货币
+func SiteCurrency(site *models.Site) string {
+	if site != nil && site.Currency != "" {
+		return site.Currency
+	}
+	return config.GetConfig().Revenue.DefaultCurrency
+}
+
+// ConvertCurrency 按汇率表换算金额
+func ConvertCurrency(amount float64, from, to string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return amount, nil
+	}
+	rates := config.GetConfig().Revenue.Rates
+	fromRate, ok := rates[from]
+	if !ok {
+		return 0, fmt.Errorf("不支持的货币: %s", from)
+	}
+	toRate, ok := rates[to]
+	if !ok {
+		return 0, fmt.Errorf("不支持的货币: %s", to)
+	}
+	return amount * fromRate / toRate, nil
+}
+
+// applyRevenue 将购买事件的金额换算为站点报表货币
+func applyRevenue(events []*models.Event) {
+	siteService := NewSiteService()
+	for _, event := range events {
+		if event.EventType != "purchase" {
+			continue
+		}
+		site, _ := siteService.GetSiteCached(event.SiteID)
+		currency := SiteCurrency(site)
+		if event.Currency == "" {
+			event.Currency = currency
+		}
+		revenue, err := ConvertCurrency(event.Amount, event.Currency, currency)
+		if err != nil {
+			// 汇率表在事件入队后发生变化，按原始金额记录
+			revenue = event.Amount
+		}
+		event.Revenue = revenue
+	}
+}
+
+// revenueKey DailyRevenue 唯一键，用于批量写入前合并增量
+type revenueKey struct {
+	SiteID    uint64
+	Date      string
+	Dimension string
+	Item      string
+}
+
+// upsertDailyRevenue 按会话入口信息汇总购买事件的收入，需在会话写入之后调用
+func upsertDailyRevenue(tx *gorm.DB, events []*models.Event) error {
+	totals := make(map[revenueKey]*models.DailyRevenue)
+	entries := make(map[sessionKey]*models.Session)
+
+	for _, event := range events {
+		if event.EventType != "purchase" || event.IsSpam {
+			continue
+		}
+		key := sessionKey{SiteID: event.SiteID, SessionID: event.SessionID}
+		entry, ok := entries[key]
+		if event.SessionID == "" {
+			// 匿名事件没有会话，归因到购买事件本身
+			entry = &models.Session{EntryURL: event.URL, Referrer: utils.NormalizeReferrer(event.Referrer), Country: event.Country}
+		} else if !ok {
+			var session models.Session
+			if err := tx.Select("entry_url", "referrer", "country").
+				Where("session_id = ? AND site_id = ?", event.SessionID, event.SiteID).
+				Take(&session).Error; err == nil && session.EntryURL != "" {
+				entry = &session
+			} else {
+				// 没有入口信息的旧会话，归因到购买事件本身
+				entry = &models.Session{EntryURL: event.URL, Referrer: utils.NormalizeReferrer(event.Referrer), Country: event.Country}
+			}
+			entries[key] = entry
+		}
+
+		date := event.CreatedAt.Format("2006-01-02")
+		for dimension, item := range map[string]string{"referrer": entry.Referrer, "landing": entry.EntryURL, "country": entry.Country} {
+			k := revenueKey{SiteID: event.SiteID, Date: date, Dimension: dimension, Item: item}
+			row, ok := totals[k]
+			if !ok {
+				day, _ := time.ParseInLocation("2006-01-02", date, time.Local)
+				row = &models.DailyRevenue{SiteID: event.SiteID, Dimension: dimension, Item: item, Date: day}
+				totals[k] = row
+			}
+			row.Revenue += event.Revenue
+			row.Orders++
+		}
+	}
+	if len(totals) == 0 {
+		return nil
+	}
+
+	// 固定写入顺序，避免多个写入协程之间互相死锁
+	rows := make([]models.DailyRevenue, 0, len(totals))
+	for _, row := range totals {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.SiteID != b.SiteID {
+			return a.SiteID < b.SiteID
+		}
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Dimension != b.Dimension {
+			return a.Dimension < b.Dimension
+		}
+		return a.Item < b.Item
+	})
+
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "site_id"}, {Name: "date"}, {Name: "dimension"}, {Name: "item"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"revenue":    gorm.Expr("daily_revenue.revenue + EXCLUDED.revenue"),
+			"orders":     gorm.Expr("daily_revenue.orders + EXCLUDED.orders"),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&rows).Error
+}
+
+// GetRevenueRank 按来源、着陆页或国家统计收入排行
+func (s *EventService) GetRevenueRank(siteID uint64, startDate, endDate, dimension string, page, pageSize int) (*[]models.RevenueStats, int64, error) {
+	var revenueStats []models.RevenueStats
+	if !revenueDimensions[dimension] {
+		return &revenueStats, 0, fmt.Errorf("不支持的统计维度: %s", dimension)
+	}
+	db := database.GetDB()
+
+	// 解析日期
+	start, err := utils.ParseDate(startDate)
+	if err != nil {
+		return &revenueStats, 0, fmt.Errorf("开始日期格式错误: %v", err)
+	}
+	end, err := utils.ParseDate(endDate)
+	if err != nil {
+		return &revenueStats, 0, fmt.Errorf("结束日期格式错误: %v", err)
+	}
+
+	// 获取排行数据
+	sql := `
+		SELECT item AS key, SUM(revenue) AS revenue, SUM(orders) AS orders
+		FROM daily_revenue
+		WHERE site_id = ? AND dimension = ? AND date BETWEEN ? AND ?
+		GROUP BY item
+		ORDER BY revenue DESC
+		LIMIT ? OFFSET ?
+	`
+	if err = db.Raw(sql, siteID, dimension, start.Format("2006-01-02"), end.Format("2006-01-02"), pageSize, (page-1)*pageSize).Scan(&revenueStats).Error; err != nil {
+		return &revenueStats, 0, fmt.Errorf("统计收入排行失败: %v", err)
+	}
+
+	// 获取总量
+	var total int64
+	sqlTotal := `
+		SELECT COUNT(DISTINCT item)
+		FROM daily_revenue
+		WHERE site_id = ? AND dimension = ? AND date BETWEEN ? AND ?
+	`
+	if err = db.Raw(sqlTotal, siteID, dimension, start.Format("2006-01-02"), end.Format("2006-01-02")).Scan(&total).Error; err != nil {
+		return &revenueStats, 0, fmt.Errorf("统计收入排行总数失败: %v", err)
+	}
+
+	return &revenueStats, total, nil
+}
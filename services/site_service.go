@@ -1,16 +1,40 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"pingoo/database"
 	"pingoo/models"
+	"pingoo/utils"
+	"strings"
+	"sync"
+	"time"
 
 	"gorm.io/gorm"
 )
 
 type SiteService struct{}
 
+// ErrIngestForbidden 上报请求未通过站点的密钥或来源校验
+var ErrIngestForbidden = errors.New("上报请求被拒绝")
+
+// siteCacheTTL 上报接口站点缓存有效期
+const siteCacheTTL = time.Minute
+
+type siteCacheEntry struct {
+	site    *models.Site // 为 nil 表示站点不存在
+	expires time.Time
+}
+
+// siteCache 上报接口使用的站点缓存，避免每次上报都查询数据库
+var siteCache = struct {
+	sync.RWMutex
+	items map[uint64]siteCacheEntry
+}{items: make(map[uint64]siteCacheEntry)}
+
 // NewSiteService 创建站点服务实例
 func NewSiteService() *SiteService {
 	return &SiteService{}
@@ -92,15 +116,213 @@ func (s *SiteService) UpdateSite(id uint64, userID uint64, siteUpdate *models.Si
 	if siteUpdate.Domain != "" {
 		site.Domain = siteUpdate.Domain
 	}
+	if siteUpdate.IngestKey != nil {
+		site.IngestKey = *siteUpdate.IngestKey
+	}
+	if siteUpdate.AllowedOrigins != nil {
+		site.AllowedOrigins = *siteUpdate.AllowedOrigins
+	}
+	if siteUpdate.StrictOrigin != nil {
+		site.StrictOrigin = *siteUpdate.StrictOrigin
+	}
+	if siteUpdate.Currency != nil {
+		currency := strings.ToUpper(*siteUpdate.Currency)
+		if currency != "" && !IsSupportedCurrency(currency) {
+			return nil, fmt.Errorf("不支持的货币: %s", currency)
+		}
+		site.Currency = currency
+	}
+	if siteUpdate.BlockedReferrers != nil {
+		site.BlockedReferrers = *siteUpdate.BlockedReferrers
+	}
+	if siteUpdate.PrivacySignal != nil {
+		site.PrivacySignal = *siteUpdate.PrivacySignal
+	}
+	if siteUpdate.Cookieless != nil {
+		site.Cookieless = *siteUpdate.Cookieless
+	}
+	if siteUpdate.IPMode != nil {
+		site.IPMode = *siteUpdate.IPMode
+	}
+	if siteUpdate.IPv4Prefix != nil {
+		site.IPv4Prefix = *siteUpdate.IPv4Prefix
+	}
+	if siteUpdate.IPv6Prefix != nil {
+		site.IPv6Prefix = *siteUpdate.IPv6Prefix
+	}
+	if siteUpdate.ExcludedIPs != nil {
+		for _, item := range utils.SplitList(*siteUpdate.ExcludedIPs) {
+			if !utils.IsValidIPOrCIDR(item) {
+				return nil, fmt.Errorf("无效的 IP 或网段: %s", item)
+			}
+		}
+		site.ExcludedIPs = *siteUpdate.ExcludedIPs
+	}
+	if siteUpdate.ExcludedPaths != nil {
+		site.ExcludedPaths = *siteUpdate.ExcludedPaths
+	}
+	if siteUpdate.TrackSPA != nil {
+		site.TrackSPA = *siteUpdate.TrackSPA
+	}
+	if siteUpdate.TrackHash != nil {
+		site.TrackHash = *siteUpdate.TrackHash
+	}
+	if siteUpdate.TrackOutbound != nil {
+		site.TrackOutbound = *siteUpdate.TrackOutbound
+	}
+	if siteUpdate.TrackDownloads != nil {
+		site.TrackDownloads = *siteUpdate.TrackDownloads
+	}
+	if siteUpdate.DownloadExtensions != nil {
+		// 统一为小写、不带点的扩展名
+		var exts []string
+		for _, ext := range utils.SplitList(*siteUpdate.DownloadExtensions) {
+			ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+			if ext == "" || strings.ContainsAny(ext, "./*?") {
+				return nil, fmt.Errorf("无效的文件扩展名: %s", ext)
+			}
+			exts = append(exts, ext)
+		}
+		site.DownloadExtensions = strings.Join(exts, ",")
+	}
 
 	db := database.GetDB()
 	if err := db.Save(site).Error; err != nil {
 		return nil, fmt.Errorf("更新站点失败: %v", err)
 	}
+	invalidateSiteCache(id)
+
+	return site, nil
+}
+
+// RegenerateIngestKey 重新生成站点的采集密钥
+func (s *SiteService) RegenerateIngestKey(id uint64, userID uint64) (*models.Site, error) {
+	site, err := s.GetSiteByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证权限
+	if site.UserID != userID {
+		return nil, errors.New("无权限修改此站点")
+	}
+
+	buf := make([]byte, 16)
+	if _, err = rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("生成密钥失败: %v", err)
+	}
+	site.IngestKey = "pk_" + hex.EncodeToString(buf)
+
+	db := database.GetDB()
+	if err := db.Model(site).Update("ingest_key", site.IngestKey).Error; err != nil {
+		return nil, fmt.Errorf("更新站点失败: %v", err)
+	}
+	invalidateSiteCache(id)
 
 	return site, nil
 }
 
+// GetSiteCached 带缓存的站点查询，供上报接口使用
+func (s *SiteService) GetSiteCached(id uint64) (*models.Site, error) {
+	siteCache.RLock()
+	entry, ok := siteCache.items[id]
+	siteCache.RUnlock()
+	if ok && time.Now().Before(entry.expires) {
+		if entry.site == nil {
+			return nil, errors.New("站点不存在")
+		}
+		return entry.site, nil
+	}
+
+	var site models.Site
+	err := database.GetDB().First(&site, id).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查询站点失败: %v", err)
+	}
+
+	entry = siteCacheEntry{expires: time.Now().Add(siteCacheTTL)}
+	if err == nil {
+		entry.site = &site
+	}
+	siteCache.Lock()
+	// 伪造的站点ID也会写入缓存，数量过多时清理过期项
+	if len(siteCache.items) >= 10000 {
+		now := time.Now()
+		for key, item := range siteCache.items {
+			if now.After(item.expires) {
+				delete(siteCache.items, key)
+			}
+		}
+	}
+	siteCache.items[id] = entry
+	siteCache.Unlock()
+
+	if entry.site == nil {
+		return nil, errors.New("站点不存在")
+	}
+	return entry.site, nil
+}
+
+// invalidateSiteCache 站点信息变更后清除缓存
+func invalidateSiteCache(id uint64) {
+	siteCache.Lock()
+	delete(siteCache.items, id)
+	siteCache.Unlock()
+}
+
+// CheckIngestAccess 校验上报请求的采集密钥和来源域名
+// origin、referer 为请求头，pageURL 为上报的页面地址（相对路径时不校验）
+func CheckIngestAccess(site *models.Site, key, origin, referer, pageURL string) error {
+	if site.IngestKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(site.IngestKey)) != 1 {
+		return fmt.Errorf("%w: 采集密钥错误", ErrIngestForbidden)
+	}
+
+	hosts := allowedHosts(site)
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	sourceHost := utils.ExtractHost(origin)
+	if sourceHost == "" {
+		sourceHost = utils.ExtractHost(referer)
+	}
+	if sourceHost == "" {
+		if site.StrictOrigin {
+			return fmt.Errorf("%w: 缺少来源信息", ErrIngestForbidden)
+		}
+	} else if !utils.MatchHost(sourceHost, hosts) {
+		return fmt.Errorf("%w: 来源域名不在允许列表中", ErrIngestForbidden)
+	}
+
+	if pageHost := utils.ExtractHost(pageURL); pageHost != "" && !utils.MatchHost(pageHost, hosts) {
+		return fmt.Errorf("%w: 页面域名不在允许列表中", ErrIngestForbidden)
+	}
+	return nil
+}
+
+// allowedHosts 站点允许上报的域名，未配置时使用站点域名及其 www 子域名
+func allowedHosts(site *models.Site) []string {
+	var hosts []string
+	for _, item := range utils.SplitList(site.AllowedOrigins) {
+		if host := utils.NormalizeHostPattern(item); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) > 0 {
+		return hosts
+	}
+
+	host := utils.NormalizeHostPattern(site.Domain)
+	if host == "" {
+		return nil
+	}
+	hosts = append(hosts, host)
+	if !strings.HasPrefix(host, "www.") {
+		hosts = append(hosts, "www."+host)
+	}
+	return hosts
+}
+
 // DeleteSite 删除站点
 func (s *SiteService) DeleteSite(id uint64, userID uint64) error {
 	site, err := s.GetSiteByID(id)
@@ -123,6 +345,7 @@ func (s *SiteService) DeleteSite(id uint64, userID uint64) error {
 	if err := db.Unscoped().Delete(&models.Site{}, id).Error; err != nil {
 		return fmt.Errorf("删除站点失败: %v", err)
 	}
+	invalidateSiteCache(id)
 
 	return nil
 }
@@ -178,6 +401,12 @@ func (s *SiteService) ClearSiteStats(siteID uint64, userID uint64) error {
 		return errors.New("删除daily_stats统计数据失败")
 	}
 
+	// 删除daily_revenue
+	if err := tx.Unscoped().Where("site_id = ?", siteID).Delete(&models.DailyRevenue{}).Error; err != nil {
+		tx.Rollback()
+		return errors.New("删除daily_revenue统计数据失败")
+	}
+
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
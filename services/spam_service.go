@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"pingoo/config"
+	"pingoo/models"
+	"pingoo/utils"
+)
+
+// ErrReferrerSpam 来源为垃圾域名，事件已丢弃
+var ErrReferrerSpam = errors.New("来源为垃圾域名，事件已丢弃")
+
+// ReferrerBlocklist 来源垃圾域名列表，由内置列表和可选的列表文件合并而成，文件修改后自动重新加载
+type ReferrerBlocklist struct {
+	path string
+
+	mu      sync.RWMutex
+	domains map[string]struct{}
+	modTime time.Time // 已加载文件的修改时间
+}
+
+var referrerBlocklist *ReferrerBlocklist
+
+// InitReferrerBlocklist 加载全局来源垃圾域名列表
+func InitReferrerBlocklist(cfg config.TrafficConfig) (*ReferrerBlocklist, error) {
+	b := &ReferrerBlocklist{path: cfg.SpamFile}
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+	referrerBlocklist = b
+	return b, nil
+}
+
+// GetReferrerBlocklist 获取全局来源垃圾域名列表，未加载时为 nil
+func GetReferrerBlocklist() *ReferrerBlocklist {
+	return referrerBlocklist
+}
+
+// Reload 重新读取列表文件，文件不存在时只使用内置列表
+func (b *ReferrerBlocklist) Reload() error {
+	domains := utils.DefaultReferrerSpamDomains()
+	var modTime time.Time
+	if b.path != "" {
+		info, err := os.Stat(b.path)
+		switch {
+		case err == nil:
+			data, err := os.ReadFile(b.path)
+			if err != nil {
+				return fmt.Errorf("读取垃圾来源列表失败: %v", err)
+			}
+			for domain := range utils.ParseDomainList(data) {
+				domains[domain] = struct{}{}
+			}
+			modTime = info.ModTime()
+		case !os.IsNotExist(err):
+			return fmt.Errorf("读取垃圾来源列表失败: %v", err)
+		}
+	}
+
+	b.mu.Lock()
+	b.domains = domains
+	b.modTime = modTime
+	b.mu.Unlock()
+	return nil
+}
+
+// Match 来源主机名是否在列表中
+func (b *ReferrerBlocklist) Match(host string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return utils.MatchDomainSet(host, b.domains)
+}
+
+// Size 列表中的域名数
+func (b *ReferrerBlocklist) Size() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.domains)
+}
+
+// changed 列表文件是否在上次加载后被修改、创建或删除
+func (b *ReferrerBlocklist) changed() bool {
+	if b.path == "" {
+		return false
+	}
+	var modTime time.Time
+	if info, err := os.Stat(b.path); err == nil {
+		modTime = info.ModTime()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return !modTime.Equal(b.modTime)
+}
+
+// StartBlocklistReloader 定期检查列表文件，修改后重新加载，ctx 结束时退出
+func StartBlocklistReloader(ctx context.Context, b *ReferrerBlocklist, interval time.Duration) {
+	if b.path == "" || interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !b.changed() {
+					continue
+				}
+				if err := b.Reload(); err != nil {
+					log.Printf("重新加载垃圾来源列表失败: %v", err)
+					continue
+				}
+				log.Printf("已重新加载垃圾来源列表，共 %d 个域名", b.Size())
+			}
+		}
+	}()
+}
+
+// IsReferrerSpam 来源是否命中全局列表或站点自定义的屏蔽域名
+func IsReferrerSpam(site *models.Site, referrer string) bool {
+	host := utils.ExtractHost(referrer)
+	if host == "" {
+		return false
+	}
+	if b := GetReferrerBlocklist(); b != nil && b.Match(host) {
+		return true
+	}
+	if site != nil && site.BlockedReferrers != "" {
+		blocked := make(map[string]struct{})
+		for _, item := range utils.SplitList(site.BlockedReferrers) {
+			if domain := utils.NormalizeHostPattern(item); domain != "" {
+				blocked[strings.TrimPrefix(domain, "*.")] = struct{}{}
+			}
+		}
+		return utils.MatchDomainSet(host, blocked)
+	}
+	return false
+}
@@ -0,0 +1,468 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pingoo/config"
+	"pingoo/database"
+)
+
+const spoolSegmentExt = ".spool"
+
+// Spool 本地追加写的事件暂存区
+// 数据库写入失败时事件以 NDJSON 格式追加到分段文件中，数据库恢复后由回放协程按顺序重新写入。
+type Spool struct {
+	dir         string
+	segmentSize int64
+
+	mu       sync.Mutex
+	file     *os.File // 当前写入的分段
+	fileSize int64
+	seq      uint64 // 当前最大分段序号
+	records  int64  // 暂存区内事件总数
+	bytes    int64  // 暂存区内数据总大小
+}
+
+// SpoolStats 暂存区指标
+type SpoolStats struct {
+	Segments int   `json:"segments"`
+	Records  int64 `json:"records"`
+	Bytes    int64 `json:"bytes"`
+}
+
+// SpoolSegment 单个分段文件信息
+type SpoolSegment struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Records int64     `json:"records"`
+	First   time.Time `json:"first"` // 最早事件接收时间
+	Last    time.Time `json:"last"`  // 最晚事件接收时间
+}
+
+var eventSpool *Spool
+
+// InitSpool 打开全局暂存区
+func InitSpool(cfg config.SpoolConfig) (*Spool, error) {
+	spool, err := OpenSpool(cfg.Dir, cfg.SegmentSize)
+	if err != nil {
+		return nil, err
+	}
+	eventSpool = spool
+	return spool, nil
+}
+
+// GetSpool 获取全局暂存区，未启用时为 nil
+func GetSpool() *Spool {
+	return eventSpool
+}
+
+// OpenSpool 打开暂存目录并统计已有数据
+func OpenSpool(dir string, segmentSize int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建暂存目录失败: %v", err)
+	}
+	if segmentSize <= 0 {
+		segmentSize = 8 << 20
+	}
+	s := &Spool{dir: dir, segmentSize: segmentSize}
+
+	names, err := s.segmentNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		seq, _ := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if seq > s.seq {
+			s.seq = seq
+		}
+		info, err := s.inspectSegment(name, false)
+		if err != nil {
+			return nil, err
+		}
+		s.records += info.Records
+		s.bytes += info.Size
+	}
+	return s, nil
+}
+
+// Append 追加一批事件并落盘
+func (s *Spool) Append(events []PendingEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	var buf strings.Builder
+	for i := range events {
+		line, err := json.Marshal(&events[i])
+		if err != nil {
+			return fmt.Errorf("序列化暂存事件失败: %v", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil || s.fileSize >= s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.WriteString(buf.String())
+	s.fileSize += int64(n)
+	s.bytes += int64(n)
+	if err != nil {
+		return fmt.Errorf("写入暂存文件失败: %v", err)
+	}
+	if err = s.file.Sync(); err != nil {
+		return fmt.Errorf("同步暂存文件失败: %v", err)
+	}
+	s.records += int64(len(events))
+	return nil
+}
+
+// Stats 返回暂存区指标
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names, _ := s.segmentNames()
+	return SpoolStats{Segments: len(names), Records: s.records, Bytes: s.bytes}
+}
+
+// Segments 列出所有分段的详细信息
+func (s *Spool) Segments() ([]SpoolSegment, error) {
+	names, err := s.segmentNames()
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]SpoolSegment, 0, len(names))
+	for _, name := range names {
+		info, err := s.inspectSegment(name, true)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, *info)
+	}
+	return segments, nil
+}
+
+// Purge 删除所有暂存数据
+func (s *Spool) Purge() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeCurrent()
+
+	names, err := s.segmentNames()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+			return fmt.Errorf("删除暂存文件失败: %v", err)
+		}
+	}
+	s.records = 0
+	s.bytes = 0
+	return nil
+}
+
+// Close 关闭当前写入的分段
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeCurrent()
+}
+
+// Replay 在数据库可用时按顺序回放所有已封存的分段，返回实际写入的事件数，隔离的事件不计入
+func (s *Spool) Replay(ctx context.Context) (int64, error) {
+	// 封存当前分段，之后的失败事件写入新分段
+	s.mu.Lock()
+	s.closeCurrent()
+	names, err := s.segmentNames()
+	s.mu.Unlock()
+	if err != nil || len(names) == 0 {
+		return 0, err
+	}
+
+	if err = database.Ping(ctx); err != nil {
+		return 0, fmt.Errorf("数据库不可用: %v", err)
+	}
+
+	eventService := NewEventService()
+	var replayed int64
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return replayed, ctx.Err()
+		}
+		path := filepath.Join(s.dir, name)
+		events, lines, size, err := readSpoolSegment(path)
+		if err != nil {
+			return replayed, err
+		}
+		written := len(events)
+		if err = eventService.CreateEventsBatch(events); err != nil {
+			// 数据库正常但整批失败，说明存在无法写入的事件，逐条回放并隔离失败事件
+			if pingErr := database.Ping(ctx); pingErr != nil {
+				return replayed, err
+			}
+			var remaining []PendingEvent
+			written, remaining, err = s.replayOneByOne(ctx, eventService, events)
+			replayed += int64(written)
+			if len(remaining) > 0 {
+				// 逐条回放中途数据库不可用，分段只保留未处理的事件，恢复后从这里继续，已写入的事件不会重复写入
+				if rewriteErr := s.rewriteSegment(path, remaining, lines, size); rewriteErr != nil {
+					return replayed, rewriteErr
+				}
+				return replayed, err
+			}
+			if err != nil {
+				return replayed, err
+			}
+		} else {
+			replayed += int64(written)
+		}
+		if err = os.Remove(path); err != nil {
+			return replayed, fmt.Errorf("删除已回放的暂存文件失败: %v", err)
+		}
+
+		s.mu.Lock()
+		s.records -= lines
+		s.bytes -= size
+		s.mu.Unlock()
+	}
+	return replayed, nil
+}
+
+// rewriteSegment 用未处理的事件替换已封存的分段，lines 和 size 为分段原有的行数和大小
+func (s *Spool) rewriteSegment(path string, events []PendingEvent, lines, size int64) error {
+	var buf strings.Builder
+	for i := range events {
+		line, err := json.Marshal(&events[i])
+		if err != nil {
+			return fmt.Errorf("序列化暂存事件失败: %v", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	// 先写临时文件再替换，中途失败时原分段保持不变
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("创建暂存文件失败: %v", err)
+	}
+	if _, err = f.WriteString(buf.String()); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("重写暂存文件失败: %v", err)
+	}
+
+	s.mu.Lock()
+	s.records -= lines - int64(len(events))
+	s.bytes -= size - int64(buf.Len())
+	s.mu.Unlock()
+	return nil
+}
+
+// StartSpoolReplayer 定期检查数据库状态并回放暂存事件，ctx 结束时退出
+func StartSpoolReplayer(ctx context.Context, spool *Spool, interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if spool.Stats().Records == 0 {
+					continue
+				}
+				replayed, err := spool.Replay(ctx)
+				if replayed > 0 {
+					log.Printf("已回放暂存事件 %d 条", replayed)
+				}
+				if err != nil && ctx.Err() == nil {
+					log.Printf("回放暂存事件失败: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// replayOneByOne 逐条写入，无法写入的事件转存到 rejected 文件，返回写入的事件数。
+// 写入失败时先检查数据库，数据库不可用时停止回放，返回尚未处理的事件，不把它们当作无法写入的事件隔离
+func (s *Spool) replayOneByOne(ctx context.Context, eventService *EventService, events []PendingEvent) (int, []PendingEvent, error) {
+	var rejected, remaining []PendingEvent
+	var written int
+	var dbErr error
+	for i := range events {
+		err := eventService.CreateEventsBatch(events[i : i+1])
+		if err == nil {
+			written++
+			continue
+		}
+		if pingErr := database.Ping(ctx); pingErr != nil {
+			remaining = events[i:]
+			dbErr = fmt.Errorf("数据库不可用: %v", pingErr)
+			break
+		}
+		log.Printf("暂存事件无法写入，已隔离: %v", err)
+		rejected = append(rejected, events[i])
+	}
+	if len(rejected) == 0 {
+		return written, remaining, dbErr
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.dir, "rejected.ndjson"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return written, nil, fmt.Errorf("打开隔离文件失败: %v", err)
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+	for i := range rejected {
+		if err = encoder.Encode(&rejected[i]); err != nil {
+			return written, nil, fmt.Errorf("写入隔离文件失败: %v", err)
+		}
+	}
+	if err = f.Sync(); err != nil {
+		return written, nil, fmt.Errorf("写入隔离文件失败: %v", err)
+	}
+	return written, remaining, dbErr
+}
+
+// rotate 关闭当前分段并创建新分段，调用方需持有锁
+func (s *Spool) rotate() error {
+	s.closeCurrent()
+	s.seq++
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.seq, spoolSegmentExt))
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("创建暂存文件失败: %v", err)
+	}
+	s.file = f
+	s.fileSize = 0
+	return nil
+}
+
+// closeCurrent 关闭当前分段，调用方需持有锁
+func (s *Spool) closeCurrent() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	s.fileSize = 0
+	return err
+}
+
+// segmentNames 按序号升序返回分段文件名
+func (s *Spool) segmentNames() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取暂存目录失败: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), spoolSegmentExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// inspectSegment 统计分段的事件数，withTimes 为 true 时解析首尾事件时间
+func (s *Spool) inspectSegment(name string, withTimes bool) (*SpoolSegment, error) {
+	path := filepath.Join(s.dir, name)
+	info := &SpoolSegment{Name: name}
+	if !withTimes {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取暂存文件失败: %v", err)
+		}
+		defer f.Close()
+		reader := bufio.NewReader(f)
+		for {
+			line, err := reader.ReadBytes('\n')
+			info.Size += int64(len(line))
+			if len(line) > 0 && line[len(line)-1] == '\n' {
+				info.Records++
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("读取暂存文件失败: %v", err)
+			}
+		}
+		return info, nil
+	}
+
+	events, lines, size, err := readSpoolSegment(path)
+	if err != nil {
+		return nil, err
+	}
+	info.Size = size
+	info.Records = lines
+	if len(events) > 0 {
+		info.First = events[0].ReceivedAt
+		info.Last = events[len(events)-1].ReceivedAt
+	}
+	return info, nil
+}
+
+// readSpoolSegment 读取分段中的所有事件，返回事件、完整行数和文件大小，忽略末尾未写完整的行
+func readSpoolSegment(path string) ([]PendingEvent, int64, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("读取暂存文件失败: %v", err)
+	}
+	defer f.Close()
+
+	var events []PendingEvent
+	var lines, size int64
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		size += int64(len(line))
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			lines++
+			var event PendingEvent
+			if jsonErr := json.Unmarshal(line, &event); jsonErr != nil {
+				log.Printf("跳过无法解析的暂存记录(%s): %v", filepath.Base(path), jsonErr)
+			} else {
+				events = append(events, event)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("读取暂存文件失败: %v", err)
+		}
+	}
+	return events, lines, size, nil
+}
@@ -28,12 +28,15 @@ func IncrementDailyPV(db *gorm.DB, siteID uint64, category, item string, date ti
 	}).Create(&stat).Error
 }
 
-// UpsertDailyStatsBatch 批量更新 DailyStats，支持 PV 累加
-func UpsertDailyStatsBatch(tx *gorm.DB, siteID uint64, updates []struct {
+// DailyStatsUpdate 单个统计维度的增量
+type DailyStatsUpdate struct {
 	Category string
 	Item     string
 	PVDelta  int64
-}, date time.Time) error {
+}
+
+// UpsertDailyStatsBatch 批量更新 DailyStats，支持 PV 累加
+func UpsertDailyStatsBatch(tx *gorm.DB, siteID uint64, updates []DailyStatsUpdate, date time.Time) error {
 
 	var stats []models.DailyStats
 	for _, u := range updates {
@@ -46,6 +49,16 @@ func UpsertDailyStatsBatch(tx *gorm.DB, siteID uint64, updates []struct {
 		})
 	}
 
+	return UpsertDailyStats(tx, stats)
+}
+
+// UpsertDailyStats 批量写入多站点、多日期的 DailyStats
+// 同一条语句内 (site_id, date, category, item) 不能重复，调用方需提前合并
+func UpsertDailyStats(tx *gorm.DB, stats []models.DailyStats) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
 	// 批量插入 + OnConflict 累加 PV
 	return tx.Clauses(clause.OnConflict{
 		Columns: []clause.Column{{Name: "site_id"}, {Name: "date"}, {Name: "category"}, {Name: "item"}},
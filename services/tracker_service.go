@@ -0,0 +1,133 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"pingoo/config"
+	"pingoo/models"
+	"pingoo/utils"
+)
+
+// TrackerScript 生成好的追踪脚本
+type TrackerScript struct {
+	Body []byte
+	Hash string // 内容哈希，用作 ETag 和脚本地址的 v 参数
+}
+
+// ETag 强 ETag
+func (t *TrackerScript) ETag() string {
+	return `"` + t.Hash + `"`
+}
+
+// trackerPreset 写入站点脚本的配置，字段名与脚本中的 cfg 一致
+type trackerPreset struct {
+	SiteID        string   `json:"siteId"`
+	APIURL        string   `json:"apiUrl,omitempty"`
+	Key           string   `json:"key,omitempty"`
+	Cookieless    bool     `json:"cookieless,omitempty"`
+	TrackHash     bool     `json:"trackHash,omitempty"`
+	ExcludedPaths []string `json:"excludedPaths,omitempty"`
+
+	TrackOutbound      bool   `json:"trackOutbound,omitempty"`
+	Domain             string `json:"domain,omitempty"` // 站点域名，去掉 www.，用于判断外链
+	TrackDownloads     bool   `json:"trackDownloads,omitempty"`
+	DownloadExtensions string `json:"downloadExtensions,omitempty"`
+}
+
+// siteTracker 站点脚本缓存，脚本相关的站点设置变化后重新生成
+type siteTracker struct {
+	key    string // 生成脚本使用的配置
+	script *TrackerScript
+}
+
+var (
+	genericTracker     *TrackerScript
+	genericTrackerErr  error
+	genericTrackerOnce sync.Once
+
+	siteTrackers   = make(map[uint64]*siteTracker)
+	siteTrackersMu sync.Mutex
+)
+
+// GenericTrackerScript 通用追踪脚本，包含全部功能，配置从 script 标签的属性读取
+func GenericTrackerScript() (*TrackerScript, error) {
+	genericTrackerOnce.Do(func() {
+		var body string
+		// 配置了上报地址时写入脚本，否则不写入任何配置
+		var preset interface{}
+		if endpoint := trackerEndpoint(); endpoint != "" {
+			preset = map[string]string{"apiUrl": endpoint}
+		}
+		body, genericTrackerErr = utils.RenderTracker(preset, nil)
+		if genericTrackerErr == nil {
+			genericTracker = newTrackerScript(body)
+		}
+	})
+	return genericTracker, genericTrackerErr
+}
+
+// SiteTrackerScript 按站点设置生成的追踪脚本，只包含站点开启的功能
+func SiteTrackerScript(site *models.Site) (*TrackerScript, error) {
+	siteID := uint64(site.ID)
+	preset := trackerPreset{
+		SiteID:     strconv.FormatUint(siteID, 10),
+		APIURL:     trackerEndpoint(),
+		Key:        site.IngestKey,
+		Cookieless: site.Cookieless,
+		TrackHash:  site.TrackHash,
+	}
+	if site.TrackOutbound {
+		preset.TrackOutbound = true
+		preset.Domain = strings.TrimPrefix(utils.NormalizeHostPattern(site.Domain), "www.")
+	}
+	if site.TrackDownloads {
+		preset.TrackDownloads = true
+		preset.DownloadExtensions = site.DownloadExtensions
+	}
+	// 脚本只处理前缀和完全匹配的规则，带其他通配符的规则仍由服务端判断
+	for _, pattern := range utils.SplitList(site.ExcludedPaths) {
+		if !strings.ContainsAny(strings.TrimSuffix(pattern, "*"), "*?[") {
+			preset.ExcludedPaths = append(preset.ExcludedPaths, pattern)
+		}
+	}
+	features := map[string]bool{
+		"spa":      site.TrackSPA,
+		"exclude":  len(preset.ExcludedPaths) > 0,
+		"outbound": site.TrackOutbound,
+		"download": site.TrackDownloads,
+	}
+	key := fmt.Sprintf("%+v %v", preset, features)
+
+	siteTrackersMu.Lock()
+	cached, ok := siteTrackers[siteID]
+	siteTrackersMu.Unlock()
+	if ok && cached.key == key {
+		return cached.script, nil
+	}
+
+	body, err := utils.RenderTracker(preset, features)
+	if err != nil {
+		return nil, err
+	}
+	script := newTrackerScript(body)
+
+	siteTrackersMu.Lock()
+	siteTrackers[siteID] = &siteTracker{key: key, script: script}
+	siteTrackersMu.Unlock()
+	return script, nil
+}
+
+func newTrackerScript(body string) *TrackerScript {
+	sum := sha256.Sum256([]byte(body))
+	return &TrackerScript{Body: []byte(body), Hash: hex.EncodeToString(sum[:8])}
+}
+
+// trackerEndpoint 配置的上报地址，为空时脚本使用自身所在域名的 /send
+func trackerEndpoint() string {
+	return config.GetConfig().Site.TrackerEndpoint
+}
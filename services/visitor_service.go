@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"pingoo/database"
+	"pingoo/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// visitorSalt 当天盐值的本地缓存，多个实例通过数据库共享同一天的盐值
+var visitorSalt struct {
+	mu   sync.Mutex
+	day  string
+	salt string
+
+	// 数据库不可用时的本地盐值，不作为当天盐值缓存，下次调用仍重新读取数据库
+	fallbackDay  string
+	fallbackSalt string
+}
+
+// VisitorID 按当天盐值、站点、IP 和 UserAgent 生成访客ID
+// 同一访客当天的ID不变，盐值每天更换且旧盐值被删除，无法再反推出 IP
+func VisitorID(siteID uint64, ip, userAgent string) string {
+	salt := currentVisitorSalt(time.Now())
+	sum := sha256.Sum256([]byte(salt + "|" + strconv.FormatUint(siteID, 10) + "|" + ip + "|" + userAgent))
+	return "v_" + hex.EncodeToString(sum[:12])
+}
+
+// currentVisitorSalt 获取当天的盐值，跨天时从数据库读取或生成新盐值
+func currentVisitorSalt(now time.Time) string {
+	day := now.Format("2006-01-02")
+
+	visitorSalt.mu.Lock()
+	defer visitorSalt.mu.Unlock()
+	if visitorSalt.day == day {
+		return visitorSalt.salt
+	}
+
+	salt, err := loadVisitorSalt(day)
+	if err != nil {
+		// 数据库不可用时使用本地盐值，保证上报不中断；恢复后改用数据库中共享的盐值
+		log.Printf("读取访客盐值失败，使用本地盐值: %v", err)
+		if visitorSalt.fallbackDay != day {
+			visitorSalt.fallbackDay = day
+			visitorSalt.fallbackSalt = randomSalt()
+		}
+		return visitorSalt.fallbackSalt
+	}
+	visitorSalt.fallbackDay, visitorSalt.fallbackSalt = "", ""
+	visitorSalt.day = day
+	visitorSalt.salt = salt
+	return salt
+}
+
+// loadVisitorSalt 读取指定日期的盐值，不存在时生成，并删除之前日期的盐值
+func loadVisitorSalt(day string) (string, error) {
+	db := database.GetDB()
+	if db == nil {
+		return "", fmt.Errorf("数据库未初始化")
+	}
+	// 多个实例同时生成时只保留先写入的盐值
+	row := models.VisitorSalt{Day: day, Salt: randomSalt()}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+		return "", err
+	}
+	var saved models.VisitorSalt
+	if err := db.Where("day = ?", day).Take(&saved).Error; err != nil {
+		return "", err
+	}
+	if err := purgeVisitorSalts(day); err != nil {
+		log.Printf("删除过期访客盐值失败: %v", err)
+	}
+	return saved.Salt, nil
+}
+
+// purgeVisitorSalts 删除指定日期之前的盐值
+func purgeVisitorSalts(day string) error {
+	return database.GetDB().Where("day < ?", day).Delete(&models.VisitorSalt{}).Error
+}
+
+func randomSalt() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("生成随机盐值失败: %v", err))
+	}
+	return hex.EncodeToString(buf)
+}
+
+// StartSaltRotator 每小时检查一次日期，跨天后更换盐值并删除旧盐值，没有上报时也不会保留超过一天，ctx 结束时退出
+func StartSaltRotator(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				currentVisitorSalt(now)
+			}
+		}
+	}()
+}
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// 流量渠道
+const (
+	ChannelDirect        = "Direct"
+	ChannelOrganicSearch = "Organic Search"
+	ChannelSocial        = "Social"
+	ChannelEmail         = "Email"
+	ChannelPaid          = "Paid"
+	ChannelReferral      = "Referral"
+	ChannelAIAssistants  = "AI Assistants"
+)
+
+//go:embed channels.json
+var defaultChannelRules []byte
+
+// ChannelRules 渠道分类规则
+type ChannelRules struct {
+	ClickIDs map[string]SourceRule `json:"click_ids"` // 点击ID参数对应的来源和渠道
+	Mediums  []MediumRule          `json:"mediums"`   // utm_medium 对应的渠道
+	Sources  []SourceRule          `json:"sources"`   // 来源域名和 utm_source 对应的规范来源名与渠道，按顺序匹配
+}
+
+// SourceRule 来源规则
+type SourceRule struct {
+	Source  string   `json:"source"`  // 规范来源名，如 Google
+	Channel string   `json:"channel"` // 渠道
+	Domains []string `json:"domains"` // 来源域名，匹配域名本身及子域名；google.* 匹配任意顶级域名
+	Aliases []string `json:"aliases"` // utm_source 的取值（小写）
+}
+
+// MediumRule utm_medium 规则
+type MediumRule struct {
+	Channel string   `json:"channel"`
+	Mediums []string `json:"mediums"` // utm_medium 的取值（小写）
+}
+
+var channelRules atomic.Pointer[ChannelRules]
+
+// LoadChannelRules 加载内置渠道规则，path 不为空时先匹配该文件中的规则，用于覆盖或补充内置规则
+func LoadChannelRules(path string) error {
+	var rules ChannelRules
+	if err := json.Unmarshal(defaultChannelRules, &rules); err != nil {
+		return fmt.Errorf("解析内置渠道规则失败: %v", err)
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("读取渠道规则文件失败: %v", err)
+		}
+		var custom ChannelRules
+		if err = json.Unmarshal(data, &custom); err != nil {
+			return fmt.Errorf("解析渠道规则文件失败: %v", err)
+		}
+		for key, rule := range custom.ClickIDs {
+			rules.ClickIDs[key] = rule
+		}
+		rules.Mediums = append(custom.Mediums, rules.Mediums...)
+		rules.Sources = append(custom.Sources, rules.Sources...)
+	}
+	channelRules.Store(&rules)
+	return nil
+}
+
+// getChannelRules 获取当前渠道规则，未加载时使用内置规则
+func getChannelRules() *ChannelRules {
+	if rules := channelRules.Load(); rules != nil {
+		return rules
+	}
+	if err := LoadChannelRules(""); err != nil {
+		return &ChannelRules{}
+	}
+	return channelRules.Load()
+}
+
+// ClassifyChannel 根据来源主机名和广告活动参数判断流量渠道和规范来源名
+// 优先级：utm 参数 > 点击ID > 来源域名；没有来源时为直接访问，无法识别的来源为外链引荐
+func ClassifyChannel(referrerHost string, campaign CampaignParams) (channel, source string) {
+	rules := getChannelRules()
+	referrerHost = strings.ToLower(referrerHost)
+
+	var matched *SourceRule
+	clickRule, hasClickID := rules.ClickIDs[campaign.ClickIDType]
+
+	// 来源名：utm_source > 点击ID对应的平台 > 来源域名
+	switch {
+	case campaign.Source != "":
+		source = campaign.Source
+		if matched = rules.matchAlias(strings.ToLower(campaign.Source)); matched != nil {
+			source = matched.Source
+		} else if referrerHost != "" {
+			// 自定义的 utm_source 保留原值，渠道仍可参考来源域名
+			matched = rules.matchDomain(referrerHost)
+		}
+	case hasClickID:
+		source = clickRule.Source
+	case referrerHost != "":
+		source = strings.TrimPrefix(referrerHost, "www.")
+		if matched = rules.matchDomain(referrerHost); matched != nil {
+			source = matched.Source
+		}
+	default:
+		source = ChannelDirect
+	}
+
+	// 渠道：utm_medium > 点击ID > 来源规则
+	if campaign.Medium != "" {
+		if channel = rules.matchMedium(strings.ToLower(campaign.Medium)); channel != "" {
+			return channel, source
+		}
+	}
+	if hasClickID {
+		return clickRule.Channel, source
+	}
+	if matched != nil {
+		return matched.Channel, source
+	}
+	if campaign.Source != "" || referrerHost != "" {
+		return ChannelReferral, source
+	}
+	return ChannelDirect, source
+}
+
+func (r *ChannelRules) matchAlias(name string) *SourceRule {
+	for i := range r.Sources {
+		if strings.ToLower(r.Sources[i].Source) == name {
+			return &r.Sources[i]
+		}
+		for _, alias := range r.Sources[i].Aliases {
+			if alias == name {
+				return &r.Sources[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (r *ChannelRules) matchDomain(host string) *SourceRule {
+	for i := range r.Sources {
+		for _, domain := range r.Sources[i].Domains {
+			if matchSourceDomain(host, domain) {
+				return &r.Sources[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (r *ChannelRules) matchMedium(medium string) string {
+	for _, rule := range r.Mediums {
+		for _, m := range rule.Mediums {
+			if m == medium {
+				return rule.Channel
+			}
+		}
+	}
+	return ""
+}
+
+// matchSourceDomain 主机名是否匹配规则域名：example.com 匹配自身及子域名，
+// example.* 匹配 example 后跟一到两级顶级域名（如 google.de、www.google.co.uk）
+func matchSourceDomain(host, domain string) bool {
+	if base, ok := strings.CutSuffix(domain, ".*"); ok {
+		labels := strings.Split(host, ".")
+		for i, label := range labels {
+			if label == base {
+				rest := len(labels) - i - 1
+				return rest >= 1 && rest <= 2
+			}
+		}
+		return false
+	}
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
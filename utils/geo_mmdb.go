@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// MMDBProvider MaxMind GeoIP2/GeoLite2 或 DB-IP 的 .mmdb 数据源，ASN 库可选
+type MMDBProvider struct {
+	city     *maxminddb.Reader
+	asn      *maxminddb.Reader
+	cityPath string
+	asnPath  string
+	language string
+}
+
+// mmdbCityRecord City/Country 库的记录
+type mmdbCityRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// mmdbASNRecord ASN 库的记录
+type mmdbASNRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// NewMMDBProvider 加载城市库和可选的 ASN 库，asnPath 为空时不查询 ASN
+func NewMMDBProvider(cityPath, asnPath, language string) (*MMDBProvider, error) {
+	city, err := openMMDB(cityPath)
+	if err != nil {
+		return nil, err
+	}
+	p := &MMDBProvider{city: city, cityPath: cityPath, language: language}
+	if asnPath != "" {
+		if p.asn, err = openMMDB(asnPath); err != nil {
+			return nil, err
+		}
+		p.asnPath = asnPath
+	}
+	return p, nil
+}
+
+// openMMDB 将整个文件读入内存后解析，不使用 mmap，避免数据库文件被覆盖更新时影响已加载的数据
+func openMMDB(path string) (*maxminddb.Reader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取 MMDB 文件失败: %v", err)
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析 MMDB 文件 %s 失败: %v", path, err)
+	}
+	return reader, nil
+}
+
+// Lookup 查询 IP 的地理位置
+func (p *MMDBProvider) Lookup(ipStr string) (*IPInfo, error) {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return nil, errors.New("无效的 IP 地址格式")
+	}
+
+	var record mmdbCityRecord
+	if err := p.city.Lookup(ip, &record); err != nil {
+		return nil, err
+	}
+	info := &IPInfo{
+		Country:     localizedName(record.Country.Names, p.language),
+		CountryCode: record.Country.ISOCode,
+		City:        localizedName(record.City.Names, p.language),
+	}
+	if len(record.Subdivisions) > 0 {
+		info.Region = localizedName(record.Subdivisions[0].Names, p.language)
+		info.RegionCode = record.Subdivisions[0].ISOCode
+	}
+	// 数据库没有对应语言的国家名时使用内置名称
+	if info.Country == "" || (p.language == GeoLanguageZH && record.Country.Names["zh-CN"] == "") {
+		if name := CountryName(info.CountryCode, p.language); name != "" {
+			info.Country = name
+		}
+	}
+
+	if p.asn != nil {
+		var asn mmdbASNRecord
+		if err := p.asn.Lookup(ip, &asn); err == nil {
+			info.ASN = asn.Number
+			info.ISP = asn.Organization
+		}
+	}
+	return info, nil
+}
+
+// Metadata 数据库的元数据
+func (p *MMDBProvider) Metadata() GeoMetadata {
+	meta := GeoMetadata{
+		Provider:     "mmdb",
+		File:         p.cityPath,
+		DatabaseType: p.city.Metadata.DatabaseType,
+		Version:      p.city.Metadata.Description["en"],
+		BuildTime:    time.Unix(int64(p.city.Metadata.BuildEpoch), 0),
+	}
+	if p.asn != nil {
+		asnBuildTime := time.Unix(int64(p.asn.Metadata.BuildEpoch), 0)
+		meta.ASNFile = p.asnPath
+		meta.ASNBuildTime = &asnBuildTime
+	}
+	return meta
+}
+
+// Close 释放数据源
+func (p *MMDBProvider) Close() error {
+	err := p.city.Close()
+	if p.asn != nil {
+		if asnErr := p.asn.Close(); err == nil {
+			err = asnErr
+		}
+	}
+	return err
+}
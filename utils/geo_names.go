@@ -0,0 +1,107 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"strings"
+	"sync"
+)
+
+// 地理位置显示语言
+const (
+	GeoLanguageZH = "zh"
+	GeoLanguageEN = "en"
+)
+
+//go:embed countries.csv
+var countriesCSV string
+
+// geoName 地区的中英文名称
+type geoName struct {
+	EN string
+	ZH string
+}
+
+// chinaRegions 中国省级行政区 ISO 3166-2 代码（不含 CN- 前缀）
+var chinaRegions = map[string]geoName{
+	"BJ": {"Beijing", "北京"}, "TJ": {"Tianjin", "天津"}, "HE": {"Hebei", "河北"}, "SX": {"Shanxi", "山西"},
+	"NM": {"Inner Mongolia", "内蒙古"}, "LN": {"Liaoning", "辽宁"}, "JL": {"Jilin", "吉林"}, "HL": {"Heilongjiang", "黑龙江"},
+	"SH": {"Shanghai", "上海"}, "JS": {"Jiangsu", "江苏"}, "ZJ": {"Zhejiang", "浙江"}, "AH": {"Anhui", "安徽"},
+	"FJ": {"Fujian", "福建"}, "JX": {"Jiangxi", "江西"}, "SD": {"Shandong", "山东"}, "HA": {"Henan", "河南"},
+	"HB": {"Hubei", "湖北"}, "HN": {"Hunan", "湖南"}, "GD": {"Guangdong", "广东"}, "GX": {"Guangxi", "广西"},
+	"HI": {"Hainan", "海南"}, "CQ": {"Chongqing", "重庆"}, "SC": {"Sichuan", "四川"}, "GZ": {"Guizhou", "贵州"},
+	"YN": {"Yunnan", "云南"}, "XZ": {"Tibet", "西藏"}, "SN": {"Shaanxi", "陕西"}, "GS": {"Gansu", "甘肃"},
+	"QH": {"Qinghai", "青海"}, "NX": {"Ningxia", "宁夏"}, "XJ": {"Xinjiang", "新疆"}, "TW": {"Taiwan", "台湾"},
+	"HK": {"Hong Kong", "香港"}, "MO": {"Macao", "澳门"},
+}
+
+var (
+	geoNamesOnce    sync.Once
+	countryNames    map[string]geoName // ISO 代码 -> 名称
+	countryCodes    map[string]string  // 中文名 -> ISO 代码
+	chinaRegionCode map[string]string  // 省级行政区中文名 -> 代码
+)
+
+func loadGeoNames() {
+	geoNamesOnce.Do(func() {
+		countryNames = make(map[string]geoName)
+		countryCodes = make(map[string]string)
+		records, _ := csv.NewReader(strings.NewReader(countriesCSV)).ReadAll()
+		for _, record := range records {
+			if len(record) != 3 {
+				continue
+			}
+			countryNames[record[0]] = geoName{EN: record[1], ZH: record[2]}
+			countryCodes[record[2]] = record[0]
+		}
+		chinaRegionCode = make(map[string]string)
+		for code, name := range chinaRegions {
+			chinaRegionCode[name.ZH] = code
+		}
+	})
+}
+
+// CountryName ISO 国家代码对应的显示名称，未知代码返回空字符串
+func CountryName(code, language string) string {
+	loadGeoNames()
+	name, ok := countryNames[strings.ToUpper(code)]
+	if !ok {
+		return ""
+	}
+	if language == GeoLanguageEN {
+		return name.EN
+	}
+	return name.ZH
+}
+
+// CountryCodeByName 由中文国家名查找 ISO 国家代码
+func CountryCodeByName(name string) string {
+	loadGeoNames()
+	return countryCodes[name]
+}
+
+// chinaRegion 由中文省份名查找省级行政区代码和名称，支持带“省”“市”“自治区”等后缀的写法
+func chinaRegion(name string) (string, geoName, bool) {
+	loadGeoNames()
+	for _, suffix := range []string{"特别行政区", "维吾尔自治区", "壮族自治区", "回族自治区", "自治区", "省", "市"} {
+		if trimmed, ok := strings.CutSuffix(name, suffix); ok && trimmed != "" {
+			name = trimmed
+			break
+		}
+	}
+	code, ok := chinaRegionCode[name]
+	if !ok {
+		return "", geoName{}, false
+	}
+	return code, chinaRegions[code], true
+}
+
+// localizedName 从 MMDB 的多语言名称中选出显示名称，缺少对应语言时使用英文
+func localizedName(names map[string]string, language string) string {
+	if language == GeoLanguageZH {
+		if name := names["zh-CN"]; name != "" {
+			return name
+		}
+	}
+	return names["en"]
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ipipdotnet/ipdb-go"
+	"github.com/xiaoqidun/qqwry"
+)
+
+// QQwryProvider 纯真 IP 库（ipdb 格式）数据源，只有中文名称，英文名称由国家和省份代码换算
+type QQwryProvider struct {
+	city     *ipdb.City
+	path     string
+	language string
+}
+
+// NewQQwryProvider 加载纯真 IP 库
+func NewQQwryProvider(path, language string) (*QQwryProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取纯真 IP 库失败: %v", err)
+	}
+	city, err := ipdb.NewCityFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析纯真 IP 库失败，仅支持 ipdb 格式: %v", err)
+	}
+	return &QQwryProvider{city: city, path: path, language: language}, nil
+}
+
+// Lookup 查询 IP 的地理位置
+func (p *QQwryProvider) Lookup(ip string) (*IPInfo, error) {
+	fields, err := p.city.Find(ip, "CN")
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("纯真 IP 库数据格式错误")
+	}
+	location := qqwry.SplitResult(fields[0], fields[1], ip)
+
+	info := &IPInfo{
+		Country:     location.Country,
+		CountryCode: CountryCodeByName(location.Country),
+		Region:      location.Province,
+		City:        location.City,
+		ISP:         location.ISP,
+	}
+	if info.CountryCode == "CN" {
+		if code, name, ok := chinaRegion(location.Province); ok {
+			info.RegionCode = code
+			if p.language == GeoLanguageEN {
+				info.Region = name.EN
+			}
+		}
+	}
+	if p.language == GeoLanguageEN && info.CountryCode != "" {
+		info.Country = CountryName(info.CountryCode, GeoLanguageEN)
+	}
+	return info, nil
+}
+
+// Metadata 数据库的元数据，版本说明取自纯真 IP 库末尾的版本记录，如“2025年07月09日IP数据”
+func (p *QQwryProvider) Metadata() GeoMetadata {
+	meta := GeoMetadata{
+		Provider:     "qqwry",
+		File:         p.path,
+		DatabaseType: "ipdb",
+		BuildTime:    p.city.BuildTime(),
+	}
+	if fields, err := p.city.Find("255.255.255.255", "CN"); err == nil && len(fields) >= 2 && fields[0] == "纯真网络" {
+		meta.Version = fields[1]
+	}
+	return meta
+}
+
+// Close 纯真 IP 库完全加载在内存中，无需释放
+func (p *QQwryProvider) Close() error {
+	return nil
+}
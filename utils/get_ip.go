@@ -1,7 +1,10 @@
 package utils
 
 import (
-	"fmt"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net"
 	"strings"
 
@@ -9,6 +12,7 @@ import (
 )
 
 // GetRealIP 从Gin Context获取真实客户端IP地址
+// 注意：会信任任意调用方发送的代理头，客户端可以伪造IP，上报接口应使用 GetRealIPWithTrust
 func GetRealIP(c *gin.Context) string {
 	// 检查 CF-Connecting-IP (Cloudflare)
 	if ip := c.GetHeader("CF-Connecting-IP"); ip != "" {
@@ -55,17 +59,37 @@ func GetRealIP(c *gin.Context) string {
 
 // GetRealIPWithTrust 获取真实IP（带信任代理验证）
 // 信任验证就是只信任特定代理服务器发送的IP头信息，防止恶意用户伪造IP地址。
-func GetRealIPWithTrust(c *gin.Context, trustedProxies []string) string {
-	remoteIP := c.ClientIP()
+// 只读取 header 这一个请求头：代理通常会原样转发客户端自带的其他IP头（如 CF-Connecting-IP），读取它们同样会被伪造
+func GetRealIPWithTrust(c *gin.Context, trustedProxies []string, header string) string {
+	// 直连的对端地址，不能用 c.ClientIP()，它本身会读取代理头
+	remoteIP, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+	if err != nil {
+		remoteIP = strings.TrimSpace(c.Request.RemoteAddr)
+	}
 
 	// 如果直连IP不在信任列表中，直接返回
 	if !isTrustedProxy(remoteIP, trustedProxies) {
-		ip, _, _ := net.SplitHostPort(c.Request.RemoteAddr)
-		return ip
+		return remoteIP
 	}
 
 	// 如果在信任列表中，则检查代理头
-	return GetRealIP(c)
+	value := c.GetHeader(header)
+	if value == "" {
+		return remoteIP
+	}
+	// X-Forwarded-For 可能经过多层代理，从右往左跳过信任的代理，第一个不受信任的地址就是客户端
+	// 最左边的值可以被客户端随意伪造，不能直接使用
+	items := strings.Split(value, ",")
+	for i := len(items) - 1; i >= 0; i-- {
+		ip := validateIP(items[i])
+		if ip == "" {
+			break
+		}
+		if i == 0 || !isTrustedProxy(ip, trustedProxies) {
+			return ip
+		}
+	}
+	return remoteIP
 }
 
 // validateIP 验证IP格式是否正确
@@ -107,19 +131,33 @@ func isPrivateIP(ip string) bool {
 
 // isTrustedProxy 检查IP是否在信任的代理列表中
 func isTrustedProxy(ip string, trustedProxies []string) bool {
+	return MatchIPList(ip, trustedProxies)
+}
+
+// IsValidIPOrCIDR 是否为合法的IP或CIDR网段
+func IsValidIPOrCIDR(value string) bool {
+	if strings.Contains(value, "/") {
+		_, _, err := net.ParseCIDR(value)
+		return err == nil
+	}
+	return net.ParseIP(value) != nil
+}
+
+// MatchIPList 检查IP是否匹配列表中的某一项，列表项可以是单个IP或CIDR网段
+func MatchIPList(ip string, list []string) bool {
 	parsedIP := net.ParseIP(ip)
 	if parsedIP == nil {
 		return false
 	}
 
-	for _, trusted := range trustedProxies {
-		if strings.Contains(trusted, "/") {
-			_, ipNet, err := net.ParseCIDR(trusted)
+	for _, item := range list {
+		if strings.Contains(item, "/") {
+			_, ipNet, err := net.ParseCIDR(item)
 			if err == nil && ipNet.Contains(parsedIP) {
 				return true
 			}
 		} else {
-			if ip == trusted {
+			if other := net.ParseIP(item); other != nil && other.Equal(parsedIP) {
 				return true
 			}
 		}
@@ -131,44 +169,51 @@ func isTrustedProxy(ip string, trustedProxies []string) bool {
 // AnonymizeIP 匿名化 IP 地址：IPv4 截断到 /24，IPv6 截断到 /64。
 // 返回匿名化后的 IP 字符串。
 func AnonymizeIP(ipStr string) (string, error) {
+	return TruncateIP(ipStr, 24, 64)
+}
+
+// TruncateIP 按前缀长度截断 IP 地址，IPv4 保留前 v4Bits 位，IPv6 保留前 v6Bits 位。
+// 无法解析时返回空字符串，错误信息中不包含原始 IP，避免写入日志
+func TruncateIP(ipStr string, v4Bits, v6Bits int) (string, error) {
 	// 1. 解析 IP 地址字符串
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
-		return ipStr, fmt.Errorf("无效的 IP 地址格式: %s", ipStr)
+		return "", errors.New("无效的 IP 地址格式")
 	}
 
 	// 2. 检查 IP 类型并进行截断 (Masking)
 	// 尝试转换为 IPv4 4字节格式。如果成功，说明是 IPv4。
 	if ip4 := ip.To4(); ip4 != nil {
-		// --- IPv4 截断到 /24 ---
-		// 子网掩码 255.255.255.0
-		mask := net.IPv4Mask(255, 255, 255, 0)
-		// 应用掩码（位与操作）
-		anonIP := ip4.Mask(mask)
-		return anonIP.String(), nil
+		mask := net.CIDRMask(clampBits(v4Bits, 32), 32)
+		return ip4.Mask(mask).String(), nil
 	}
 
-	// 如果不是 IPv4，则假设是 IPv6
+	// 如果不是 IPv4，则是 IPv6（16 字节）
 	if len(ip) == net.IPv6len {
-		// --- IPv6 截断到 /64 ---
-		// IPv6 地址是 16 字节（128 位）。/64 意味着保留前 8 个字节（64 位）。
-		// 掩码前 8 字节为 255，后 8 字节为 0。
-		maskBytes := make([]byte, net.IPv6len)
-		// 设置前 8 字节为 255 (保留网络前缀)
-		for i := 0; i < 8; i++ {
-			maskBytes[i] = 0xFF
-		}
-
-		// 创建 IPv6 掩码
-		mask := net.IPMask(maskBytes)
-
-		// 应用掩码
-		anonIP := ip.Mask(mask)
-		return anonIP.String(), nil
+		mask := net.CIDRMask(clampBits(v6Bits, 128), 128)
+		return ip.Mask(mask).String(), nil
 	}
 
 	// 既不是标准的 IPv4，也不是标准的 IPv6
-	return ipStr, fmt.Errorf("不支持的 IP 地址类型或长度: %s", ipStr)
+	return "", errors.New("不支持的 IP 地址类型或长度")
+}
+
+// HashIP 用密钥计算 IP 的 HMAC-SHA256，结果以 h_ 开头，同一 IP 的结果固定但无法还原
+func HashIP(key, ipStr string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(ipStr))
+	return "h_" + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// clampBits 将前缀长度限制在 [0, size] 之间
+func clampBits(bits, size int) int {
+	if bits < 0 {
+		return 0
+	}
+	if bits > size {
+		return size
+	}
+	return bits
 }
 
 // ===== 使用示例 =====
@@ -194,7 +239,7 @@ func test() {
 			// 添加你的Nginx/CDN IP
 		}
 
-		realIP := GetRealIPWithTrust(c, trustedProxies)
+		realIP := GetRealIPWithTrust(c, trustedProxies, "X-Forwarded-For")
 
 		c.JSON(200, gin.H{
 			"ip": realIP,
@@ -226,9 +271,9 @@ func RealIPMiddleware() gin.HandlerFunc {
 }
 
 // RealIPMiddlewareWithTrust 带信任验证的中间件
-func RealIPMiddlewareWithTrust(trustedProxies []string) gin.HandlerFunc {
+func RealIPMiddlewareWithTrust(trustedProxies []string, header string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		realIP := GetRealIPWithTrust(c, trustedProxies)
+		realIP := GetRealIPWithTrust(c, trustedProxies, header)
 		c.Set("real_ip", realIP)
 		c.Next()
 	}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"net/url"
+	"path"
 	"strings"
 )
 
@@ -20,3 +21,110 @@ func NormalizeReferrer(referrer string) string {
 
 	return host
 }
+
+// ExtractHost 从完整URL（如 Origin、Referer）中提取小写主机名，不含端口；无法解析或不是绝对地址时返回空
+func ExtractHost(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// NormalizeHostPattern 规范化用户填写的域名，支持带协议、端口、路径以及 *.example.com 通配
+func NormalizeHostPattern(pattern string) string {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if i := strings.Index(pattern, "://"); i >= 0 {
+		pattern = pattern[i+3:]
+	}
+	if i := strings.IndexAny(pattern, "/?#"); i >= 0 {
+		pattern = pattern[:i]
+	}
+	if i := strings.LastIndex(pattern, ":"); i >= 0 && !strings.Contains(pattern, "]") {
+		pattern = pattern[:i]
+	}
+	return strings.Trim(pattern, "[]")
+}
+
+// MatchHost 判断主机名是否匹配任一规则，*.example.com 匹配所有子域名
+func MatchHost(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		if pattern == host {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitList 拆分逗号、空白或换行分隔的配置项，忽略空项
+func SplitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+}
+
+// MatchPathPattern 页面路径是否匹配规则：以 * 结尾时按前缀匹配（/admin/* 匹配 /admin 下所有页面），
+// 包含其他通配符时按 path.Match 匹配，否则要求完全相同。路径中的查询字符串和锚点会被忽略
+func MatchPathPattern(pattern, urlPath string) bool {
+	if i := strings.IndexAny(urlPath, "?#"); i >= 0 {
+		urlPath = urlPath[:i]
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok && !strings.ContainsAny(prefix, "*?[") {
+		return strings.HasPrefix(urlPath, prefix) || urlPath == strings.TrimSuffix(prefix, "/")
+	}
+	if strings.ContainsAny(pattern, "*?[") {
+		matched, _ := path.Match(pattern, urlPath)
+		return matched
+	}
+	return urlPath == pattern
+}
+
+// CampaignParams 从页面地址中提取的 UTM 参数和广告点击ID
+type CampaignParams struct {
+	Source      string
+	Medium      string
+	Campaign    string
+	Term        string
+	Content     string
+	ClickIDType string // 点击ID类型，如 gclid、fbclid
+	ClickID     string
+}
+
+// clickIDParams 广告平台的点击ID参数，按优先级排列
+var clickIDParams = []string{"gclid", "gbraid", "wbraid", "dclid", "msclkid", "fbclid", "ttclid", "twclid", "li_fat_id", "yclid"}
+
+// ParseCampaign 解析查询字符串（可带前导 ?）中的 UTM 参数和点击ID，值最长保留 255 个字符
+func ParseCampaign(rawQuery string) CampaignParams {
+	var params CampaignParams
+	values, err := url.ParseQuery(strings.TrimPrefix(rawQuery, "?"))
+	if err != nil && len(values) == 0 {
+		return params
+	}
+	get := func(key string) string {
+		value := []rune(strings.TrimSpace(values.Get(key)))
+		if len(value) > 255 {
+			value = value[:255]
+		}
+		return string(value)
+	}
+	params.Source = get("utm_source")
+	params.Medium = get("utm_medium")
+	params.Campaign = get("utm_campaign")
+	params.Term = get("utm_term")
+	params.Content = get("utm_content")
+	for _, key := range clickIDParams {
+		if value := get(key); value != "" {
+			params.ClickIDType = key
+			params.ClickID = value
+			break
+		}
+	}
+	return params
+}
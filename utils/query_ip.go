@@ -1,53 +1,89 @@
 package utils
 
 import (
+	"errors"
 	"sync"
-
-	"github.com/xiaoqidun/qqwry"
+	"time"
+	"unicode/utf8"
 )
 
+// IPInfo 存储查询结果，各数据源的结果统一为以下字段
+type IPInfo struct {
+	Country     string // 国家
+	CountryCode string // ISO 3166-1 两位国家代码，如 CN、US
+	Region      string // 省/州
+	RegionCode  string // ISO 3166-2 地区代码（不含国家前缀），如 GD、CA
+	City        string // 城市
+	ISP         string // 运营商，MMDB 数据源为 ASN 所属组织
+	ASN         uint   // 自治系统号，数据源不提供时为 0
+}
+
+// ErrGeoNotLoaded 未加载地理位置数据源
+var ErrGeoNotLoaded = errors.New("IP 地理位置数据源未加载")
+
+// 名称字段最大长度，与 events 表的字段长度一致
+const maxGeoNameLength = 32
+
+// GeoMetadata 地理位置数据库的元数据
+type GeoMetadata struct {
+	Provider     string     `json:"provider"`                 // 数据源：qqwry 或 mmdb
+	File         string     `json:"file,omitempty"`           // 数据库文件路径
+	DatabaseType string     `json:"database_type"`            // 数据库类型，如 GeoLite2-City
+	Version      string     `json:"version,omitempty"`        // 数据库自带的版本说明
+	BuildTime    time.Time  `json:"build_time"`               // 数据库生成时间
+	ASNFile      string     `json:"asn_file,omitempty"`       // ASN 库文件路径
+	ASNBuildTime *time.Time `json:"asn_build_time,omitempty"` // ASN 库生成时间，未加载 ASN 库时为空
+}
+
+// GeoProvider IP 地理位置数据源
+type GeoProvider interface {
+	// Lookup 查询 IP 的地理位置，名称使用创建数据源时指定的语言
+	Lookup(ip string) (*IPInfo, error)
+	// Metadata 数据库的元数据
+	Metadata() GeoMetadata
+	// Close 释放数据源占用的资源
+	Close() error
+}
+
 var (
-	ipDBLoaded bool
-	ipDBMutex  sync.Mutex
+	geoProvider   GeoProvider
+	geoProviderMu sync.RWMutex
 )
 
-// IPInfo 存储查询结果
-type IPInfo struct {
-	Country string // 国家
-	Region  string // 省/州
-	City    string // 城市
-	ISP     string // 运营商
+// SetGeoProvider 设置全局地理位置数据源，返回之前的数据源。
+// 返回时已没有查询在使用旧数据源，调用方可以直接关闭它
+func SetGeoProvider(provider GeoProvider) GeoProvider {
+	geoProviderMu.Lock()
+	defer geoProviderMu.Unlock()
+	old := geoProvider
+	geoProvider = provider
+	return old
 }
 
 // QueryIP 查询 IP 的国家、省/州、城市、运营商
 func QueryIP(ipStr string) (*IPInfo, error) {
-	// 确保IP数据库只加载一次
-	ipDBMutex.Lock()
-	if !ipDBLoaded {
-		if err := qqwry.LoadFile("public/qqwry.ipdb"); err != nil {
-			ipDBMutex.Unlock()
-			return nil, err
-		}
-		ipDBLoaded = true
+	// 查询期间持有读锁，替换数据源时等待正在进行的查询结束
+	geoProviderMu.RLock()
+	if geoProvider == nil {
+		geoProviderMu.RUnlock()
+		return nil, ErrGeoNotLoaded
 	}
-	ipDBMutex.Unlock()
-	
-	location, err := qqwry.QueryIP(ipStr)
+	info, err := geoProvider.Lookup(ipStr)
+	geoProviderMu.RUnlock()
 	if err != nil {
 		return nil, err
 	}
-	// fmt.Printf("国家：%s，省份：%s，城市：%s，区县：%s，运营商：%s\n",
-	// 	location.Country,
-	// 	location.Province,
-	// 	location.City,
-	// 	location.District,
-	// 	location.ISP,
-	// )
-	info := &IPInfo{
-		Country: location.Country,
-		Region:  location.Province,
-		City:    location.City,
-		ISP:     location.ISP,
-	}
+	info.Country = TruncateRunes(info.Country, maxGeoNameLength)
+	info.Region = TruncateRunes(info.Region, maxGeoNameLength)
+	info.City = TruncateRunes(info.City, maxGeoNameLength)
+	info.ISP = TruncateRunes(info.ISP, maxGeoNameLength)
 	return info, nil
 }
+
+// TruncateRunes 按字符截断字符串
+func TruncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"strings"
+)
+
+//go:embed referrer_spam.txt
+var defaultReferrerSpam []byte
+
+// DefaultReferrerSpamDomains 内置的来源垃圾域名列表
+func DefaultReferrerSpamDomains() map[string]struct{} {
+	return ParseDomainList(defaultReferrerSpam)
+}
+
+// ParseDomainList 解析每行一个域名的列表，忽略空行和 # 开头的注释
+func ParseDomainList(data []byte) map[string]struct{} {
+	domains := make(map[string]struct{})
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if domain := NormalizeHostPattern(line); domain != "" {
+			domains[strings.TrimPrefix(domain, "*.")] = struct{}{}
+		}
+	}
+	return domains
+}
+
+// MatchDomainSet 主机名或其任一上级域名是否在集合中
+func MatchDomainSet(host string, domains map[string]struct{}) bool {
+	host = strings.ToLower(host)
+	for host != "" {
+		if _, ok := domains[host]; ok {
+			return true
+		}
+		i := strings.Index(host, ".")
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return false
+}
@@ -22,6 +22,15 @@ func Success(c *gin.Context, data interface{}) {
 	})
 }
 
+// Accepted 返回已接收响应，用于异步处理的请求
+func Accepted(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusAccepted, Response{
+		Code: 0,
+		Msg:  "accepted",
+		Data: data,
+	})
+}
+
 // Fail 返回失败响应
 func Fail(c *gin.Context, msg string) {
 	c.JSON(http.StatusBadRequest, Response{
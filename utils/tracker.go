@@ -0,0 +1,135 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//go:embed tracker.js
+var trackerSource string
+
+// trackerPresetMark 脚本中写入站点配置的位置
+const trackerPresetMark = "/*PINGOO_PRESET*/null"
+
+// RenderTracker 生成压缩后的追踪脚本。preset 为写入脚本的站点配置，为 nil 时生成从 script 标签属性读取配置的通用脚本；
+// features 为 nil 时保留全部功能，否则去掉未开启的 // #if 功能块
+func RenderTracker(preset interface{}, features map[string]bool) (string, error) {
+	presetJSON := []byte("null")
+	if preset != nil {
+		var err error
+		if presetJSON, err = json.Marshal(preset); err != nil {
+			return "", fmt.Errorf("序列化追踪脚本配置失败: %v", err)
+		}
+	}
+	src := strings.Replace(stripTrackerFeatures(trackerSource, features), trackerPresetMark, string(presetJSON), 1)
+	return MinifyJS(src), nil
+}
+
+// stripTrackerFeatures 去掉未开启的功能块，功能块以 // #if 名称 开始、// #endif 结束，不支持嵌套
+func stripTrackerFeatures(src string, features map[string]bool) string {
+	var b strings.Builder
+	skipping := false
+	for _, line := range strings.SplitAfter(src, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if name, ok := strings.CutPrefix(trimmed, "// #if "); ok {
+			skipping = features != nil && !features[strings.TrimSpace(name)]
+			continue
+		}
+		if trimmed == "// #endif" {
+			skipping = false
+			continue
+		}
+		if !skipping {
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+// jsPunctuation 前后不需要空白的符号
+const jsPunctuation = "{}()[];,=:<>+-*/?|&!."
+
+// MinifyJS 去掉注释和多余空白，字符串和模板字符串原样保留。
+// 只适用于追踪脚本这类不含正则字面量的代码，语句间的换行原样保留
+func MinifyJS(src string) string {
+	var out strings.Builder
+	out.Grow(len(src))
+	var last byte // 已输出的最后一个字符
+	write := func(s string) {
+		out.WriteString(s)
+		if s != "" {
+			last = s[len(s)-1]
+		}
+	}
+	for i := 0; i < len(src); {
+		ch := src[i]
+		switch {
+		case ch == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case ch == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end + 4
+			}
+		case ch == '"' || ch == '\'' || ch == '`':
+			j := i + 1
+			for j < len(src) && src[j] != ch {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				j = len(src) - 1
+			}
+			write(src[i : j+1])
+			i = j + 1
+		case isJSSpace(ch):
+			j, newline := i, false
+			for j < len(src) && isJSSpace(src[j]) {
+				if src[j] == '\n' {
+					newline = true
+				}
+				j++
+			}
+			var next byte
+			if j < len(src) {
+				next = src[j]
+			}
+			switch {
+			case last == 0 || next == 0:
+			case newline && (last == ')' || last == ']' || isJSWord(last)) && isJSWord(next):
+				// 保留换行而不是插入分号，由浏览器按原样自动补分号，避免 else、return 等换行后语义改变
+				write("\n")
+			case !isJSPunct(last) && !isJSPunct(next):
+				write(" ")
+			}
+			i = j
+		default:
+			out.WriteByte(ch)
+			last = ch
+			i++
+		}
+	}
+	return strings.ReplaceAll(out.String(), ";}", "}")
+}
+
+func isJSSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isJSPunct(c byte) bool {
+	return strings.IndexByte(jsPunctuation, c) >= 0
+}
+
+// isJSWord 标识符、数字或字符串引号
+func isJSWord(c byte) bool {
+	return c == '_' || c == '$' || c == '\'' || c == '"' || c == '`' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,255 @@
+(function(w, d) {
+    // 服务端写入的配置：按站点生成的脚本包含站点设置，通用脚本只可能包含上报地址，其余从 script 标签的属性读取
+    const preset = /*PINGOO_PRESET*/null;
+    const cfg = {apiUrl: '', siteId: ''};
+    const currentScript = d.currentScript;
+    function getScriptConfig() {
+        let script = preset ? currentScript : null;
+        if (!script) {
+            for (const s of d.getElementsByTagName('script')) {
+                if (s.getAttribute('site-id')) {
+                    script = s;
+                    break;
+                }
+            }
+        }
+        const attr = name => (script && script.getAttribute(name)) || '';
+        const flag = name => !!script && script.hasAttribute(name);
+        Object.assign(cfg, preset);
+        cfg.siteId = cfg.siteId || attr('site-id');
+        if (!cfg.apiUrl) {
+            try {
+                cfg.apiUrl = new URL(script.src).origin + '/send';
+            } catch {
+                cfg.apiUrl = '/send';
+            }
+        }
+        cfg.userId = attr('user-id');
+        cfg.key = cfg.key || attr('ingest-key');
+        cfg.respectDnt = flag('respect-dnt');
+        cfg.cookieless = cfg.cookieless || flag('cookieless');
+        cfg.trackHash = cfg.trackHash || flag('track-hash');
+        cfg.trackOutbound = cfg.trackOutbound || flag('track-outbound');
+        cfg.trackDownloads = cfg.trackDownloads || flag('track-downloads');
+        // track-downloads 属性值可以指定下载文件扩展名，逗号分隔
+        cfg.downloadExtensions = cfg.downloadExtensions || attr('track-downloads');
+    }
+    function getSessionId(){
+        let k="pingoo_sess",t=18e5,n=Date.now(),d=JSON.parse(localStorage.getItem(k)||"{}");
+        if(!d.id||n-d.t>t)d={id:"s_"+Math.random().toString(36).slice(2)+"_"+n,t:n};
+        else d.t=n;
+        localStorage.setItem(k,JSON.stringify(d));
+        return d.id;
+    }
+    // 读写 localStorage，浏览器禁用存储时忽略
+    function storage(key, value) {
+        try {
+            if (value === undefined) return localStorage.getItem(key);
+            value === null ? localStorage.removeItem(key) : localStorage.setItem(key, value);
+        } catch {}
+        return null;
+    }
+    // 访客手动退出（localStorage 中 pingoo_optout 为 1），或脚本带 respect-dnt 属性且浏览器开启了 DNT/GPC
+    function isOptedOut() {
+        if (storage('pingoo_optout') === '1') return true;
+        return cfg.respectDnt && (navigator.doNotTrack === '1' || w.doNotTrack === '1' || navigator.globalPrivacyControl === true);
+    }
+    // 当前页面地址，带 track-hash 属性时包含 hash 路由
+    function currentUrl() {
+        return w.location.pathname + (cfg.trackHash ? w.location.hash : '');
+    }
+    // #if exclude
+    // 站点排除的页面路径不上报，规则同服务端：以 * 结尾时按前缀匹配，否则要求完全相同
+    function isExcludedPath(path) {
+        path = path.split('#')[0];
+        for (const p of cfg.excludedPaths || []) {
+            if (p.slice(-1) === '*' ? path.indexOf(p.slice(0, -1)) === 0 || path + '/' === p.slice(0, -1) : path === p) return true;
+        }
+        return false;
+    }
+    // #endif
+    // 当前页面，单页应用路由切换或 pingoo.pageview 后，来源为切换前的页面；id 为页面浏览的事件ID
+    const page = {url: '', query: '', referrer: d.referrer, id: ''};
+    // 上报事件，返回事件ID，未上报时返回空；extra 为附加字段
+    function sendEvent(type, value, properties, extra) {
+        if (!cfg.siteId || isOptedOut()) return;
+        // #if exclude
+        if (isExcludedPath(page.url)) return;
+        // #endif
+        const id = 'e_' + Math.random().toString(36).slice(2) + Date.now().toString(36);
+        const body = JSON.stringify(Object.assign({
+            // 无 Cookie 模式不在本地保存会话，由服务端生成访客ID
+            session_id: cfg.cookieless ? undefined : getSessionId(),
+            site_id: cfg.siteId,
+            user_id: cfg.userId || '',
+            url: page.url,
+            query: page.query || undefined,
+            referrer: page.referrer,
+            event_type: type,
+            event_value: value || '',
+            properties: properties || undefined,
+            screen: screen.width + 'x' + screen.height,
+            event_id: id,
+            key: cfg.key || undefined
+        }, extra));
+        // event_id 在同一事件的重试间保持不变，服务端据此去重
+        // sendBeacon 以 text/plain 发送，不触发 CORS 预检，页面卸载时也不会丢失
+        if (!navigator.sendBeacon || !navigator.sendBeacon(cfg.apiUrl, body)) fetch(cfg.apiUrl, {method: 'POST', body: body, keepalive: true});
+        return id;
+    }
+    // 当前页面浏览的互动数据：页面在前台的累计毫秒数、本次进入前台的时间和最大滚动深度
+    const engagement = {time: 0, since: 0, scroll: 0, sent: ''};
+    function isVisible() {
+        return d.visibilityState === 'visible';
+    }
+    function updateScroll() {
+        const el = d.documentElement, max = el.scrollHeight - w.innerHeight;
+        const depth = max > 0 ? Math.round(Math.min(1, (w.scrollY || el.scrollTop) / max) * 100) : 100;
+        if (depth > engagement.scroll) engagement.scroll = depth;
+    }
+    // 上报当前页面的停留时长（秒）和滚动深度，都是累计值，与上次相同时不上报
+    function sendEngagement() {
+        if (!page.id) return;
+        updateScroll();
+        if (engagement.since) {
+            engagement.time += Date.now() - engagement.since;
+            engagement.since = isVisible() ? Date.now() : 0;
+        }
+        const data = {engaged_time: Math.round(engagement.time / 1000), scroll_depth: engagement.scroll};
+        const key = page.id + ' ' + data.engaged_time + ' ' + data.scroll_depth;
+        if (key === engagement.sent) return;
+        engagement.sent = key;
+        sendEvent('engagement', page.id, undefined, data);
+    }
+    // 页面切到后台或关闭时上报，回到前台时重新计时
+    function watchEngagement() {
+        d.addEventListener('visibilitychange', () => {
+            if (isVisible()) engagement.since = engagement.since || Date.now();
+            else sendEngagement();
+        });
+        w.addEventListener('pagehide', sendEngagement);
+        w.addEventListener('scroll', updateScroll, {passive: true});
+        // 长时间停留在前台时定期上报，避免关闭页面时的上报丢失
+        setInterval(() => isVisible() && sendEngagement(), 30000);
+    }
+    // 记录一次页面浏览，url 为空时使用当前地址，也可以传入虚拟页面地址
+    function pageview(url) {
+        let loc = w.location;
+        if (url) {
+            try {
+                loc = new URL(url, w.location.href);
+            } catch {
+                return;
+            }
+        }
+        // 先上报上一个页面的互动数据
+        sendEngagement();
+        if (page.url) page.referrer = w.location.origin + page.url;
+        page.url = loc.pathname + (cfg.trackHash ? loc.hash : '');
+        page.query = loc.search;
+        page.id = sendEvent('page_view', '') || '';
+        Object.assign(engagement, {time: 0, since: isVisible() ? Date.now() : 0, scroll: 0});
+    }
+    // #if spa
+    // 路由切换时记录页面浏览，只改变查询参数或重复触发时不记录
+    function onRouteChange() {
+        if (currentUrl() !== page.url) pageview();
+    }
+    // 监听 history.pushState/replaceState、浏览器前进后退，以及 track-hash 时的 hash 变化
+    function watchRoutes() {
+        for (const name of ['pushState', 'replaceState']) {
+            const original = history[name];
+            history[name] = function() {
+                const result = original.apply(this, arguments);
+                onRouteChange();
+                return result;
+            };
+        }
+        w.addEventListener('popstate', onRouteChange);
+        if (cfg.trackHash) w.addEventListener('hashchange', onRouteChange);
+    }
+    // #endif
+    // #if outbound
+    // 站点域名及其子域名、当前域名以外的链接为外链
+    function isOutbound(link) {
+        let domain = cfg.domain || w.location.hostname;
+        if (domain.indexOf('www.') === 0) domain = domain.slice(4);
+        const host = link.hostname;
+        return host !== w.location.hostname && host !== domain && host.slice(-domain.length - 1) !== '.' + domain;
+    }
+    // #endif
+    // #if download
+    const downloadExtensions = 'pdf,zip,rar,7z,gz,tgz,tar,bz2,xz,dmg,exe,msi,pkg,deb,rpm,apk,iso,csv,txt,doc,docx,xls,xlsx,ppt,pptx,epub,mp3,mp4,mov,avi,wav';
+    // 带 download 属性或扩展名属于下载文件的链接
+    function isDownload(link) {
+        if (link.hasAttribute('download')) return true;
+        const name = link.pathname.split('/').pop(), dot = name.lastIndexOf('.');
+        const exts = (cfg.downloadExtensions || downloadExtensions).toLowerCase().split(',');
+        return dot > 0 && exts.indexOf(name.slice(dot + 1).toLowerCase()) >= 0;
+    }
+    // #endif
+    // 点击链接时上报下载或外链，下载优先；目标地址去掉 hash，截断到事件值的长度上限
+    function trackLink(e) {
+        const link = e.target.closest && e.target.closest('a[href]');
+        if (!link || (link.protocol !== 'http:' && link.protocol !== 'https:')) return;
+        const href = link.href.split('#')[0].slice(0, 255);
+        // #if download
+        if (cfg.trackDownloads && isDownload(link)) return sendEvent('download', href);
+        // #endif
+        // #if outbound
+        if (cfg.trackOutbound && isOutbound(link)) sendEvent('outbound', href);
+        // #endif
+    }
+    // 公开接口：pingoo.track(name, props)、pingoo.identify(userId)、pingoo.pageview(url)、pingoo.optOut()、pingoo.optIn()，
+    // 也可以写成 pingoo('track', name, props)
+    const api = function(method) {
+        if (typeof api[method] === 'function') api[method].apply(api, Array.prototype.slice.call(arguments, 1));
+    };
+    api.track = function(name, properties) {
+        if (!name) return;
+        sendEvent('custom', String(name), properties);
+    };
+    // 登录后关联用户ID，之后的事件和当前会话都会带上；无 Cookie 模式下只在当前页面有效
+    api.identify = function(userId) {
+        cfg.userId = userId ? String(userId) : '';
+        if (!cfg.cookieless) storage('pingoo_uid', cfg.userId || null);
+    };
+    api.pageview = pageview;
+    api.optOut = function() {
+        storage('pingoo_optout', '1');
+    };
+    api.optIn = function() {
+        storage('pingoo_optout', null);
+    };
+    function init() {
+        getScriptConfig();
+        if (!cfg.siteId) {
+            console.error('请配置site-id');
+            return;
+        }
+        if (!cfg.userId && !cfg.cookieless) cfg.userId = storage('pingoo_uid') || '';
+        // 脚本加载前排队的调用：identify 等设置先执行，让首次页面浏览带上用户ID；track 等在首次页面浏览之后按顺序执行
+        const queue = (w.pingoo && w.pingoo.q) || [], later = [];
+        w.pingoo = api;
+        for (const args of queue) {
+            if (args[0] === 'identify' || args[0] === 'optOut' || args[0] === 'optIn') api.apply(null, args);
+            else later.push(args);
+        }
+        pageview();
+        watchEngagement();
+        for (const args of later) api.apply(null, args);
+        // #if spa
+        watchRoutes();
+        // #endif
+        d.addEventListener('click', e => {
+            const el = e.target.closest('[pingoo-event]');
+            if (el) sendEvent('custom', el.getAttribute('pingoo-event'));
+        });
+        // 中键点击在新标签页打开链接，不触发 click
+        if (cfg.trackOutbound || cfg.trackDownloads) {
+            d.addEventListener('click', trackLink);
+            d.addEventListener('auxclick', e => e.button === 1 && trackLink(e));
+        }
+    }
+    d.readyState === 'loading' ? d.addEventListener('DOMContentLoaded', init) : init();
+})(window, document);
\ No newline at end of file